@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// 分段默认值
+const (
+	DefaultChunkMaxChars    = 4000
+	DefaultChunkMaxTokens   = 3000
+	DefaultChunkOverlap     = 3
+	DefaultChunkConcurrency = 2
+)
+
+// ChunkConfig 长脚本分段分析的配置，数值不大于0时使用默认值
+type ChunkConfig struct {
+	Disabled    bool `json:"disabled"`    // 关闭分段，整个脚本一次发送
+	MaxChars    int  `json:"max_chars"`   // 每段文本的最大字符数
+	MaxTokens   int  `json:"max_tokens"`  // 每段的最大估算token数
+	Overlap     int  `json:"overlap"`     // 每段前附带的上一段对话条数，仅作为上下文
+	Concurrency int  `json:"concurrency"` // 同时进行的分段请求数
+}
+
+// withDefaults 返回填充了默认值的配置
+func (c ChunkConfig) withDefaults() ChunkConfig {
+	if c.MaxChars <= 0 {
+		c.MaxChars = DefaultChunkMaxChars
+	}
+	if c.MaxTokens <= 0 {
+		c.MaxTokens = DefaultChunkMaxTokens
+	}
+	if c.Overlap < 0 {
+		c.Overlap = 0
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultChunkConcurrency
+	}
+	return c
+}
+
+// ToneChunk 一段待分析的对话
+type ToneChunk struct {
+	Context   []model.PreDialogue // 上一段末尾的对话，只用于提供上下文
+	Dialogues []model.PreDialogue // 本段需要分析的对话
+}
+
+// ToneReport 分段分析的结果报告
+type ToneReport struct {
+	Chunks       int   // 分段数
+	Updated      int   // 获得语气的对话数
+	MissingSteps []int // 分析后仍没有语气的对话step
+}
+
+// ChunkedToneAnalyzer 将长脚本按长度分段，并发交给内部分析器，再按来源文件和 Step 合并结果
+type ChunkedToneAnalyzer struct {
+	Analyzer ToneAnalyzer
+	Config   ChunkConfig
+}
+
+// NewChunkedToneAnalyzer 创建分段语气分析器
+func NewChunkedToneAnalyzer(analyzer ToneAnalyzer, config ChunkConfig) *ChunkedToneAnalyzer {
+	return &ChunkedToneAnalyzer{Analyzer: analyzer, Config: config}
+}
+
+// Analyze 实现 ToneAnalyzer 接口
+func (a *ChunkedToneAnalyzer) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	result, report, err := a.AnalyzeWithReport(ctx, dialogues)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.MissingSteps) > 0 {
+		fmt.Printf("以下 %d 条对话未获得语气，step: %v\n", len(report.MissingSteps), report.MissingSteps)
+	}
+	return result, nil
+}
+
+// AnalyzeWithReport 分段分析对话语气，并返回未获得语气的对话报告
+func (a *ChunkedToneAnalyzer) AnalyzeWithReport(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, ToneReport, error) {
+	if len(dialogues) == 0 {
+		return nil, ToneReport{}, fmt.Errorf("对话列表不能为空")
+	}
+
+	config := a.Config.withDefaults()
+	var chunks []ToneChunk
+	if config.Disabled {
+		chunks = []ToneChunk{{Dialogues: dialogues}}
+	} else {
+		chunks = SplitToneChunks(dialogues, config)
+	}
+	if len(chunks) > 1 {
+		fmt.Printf("对话共 %d 条，分为 %d 段进行语气分析\n", len(dialogues), len(chunks))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]model.PreDialogue, len(chunks))
+	var firstErr error
+	var once sync.Once
+	sem := make(chan struct{}, config.Concurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk ToneChunk) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			result, err := a.analyzeChunk(ctx, chunk)
+			if err != nil {
+				// 只记录最先失败的一段，并取消其余请求
+				once.Do(func() {
+					firstErr = fmt.Errorf("第 %d/%d 段语气分析失败: %w", i+1, len(chunks), err)
+					cancel()
+				})
+				return
+			}
+			results[i] = result
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, ToneReport{}, firstErr
+	}
+	// 调用方取消时可能没有任何一段返回错误
+	if err := ctx.Err(); err != nil {
+		return nil, ToneReport{}, err
+	}
+
+	result, report := mergeToneChunks(dialogues, chunks, results)
+	report.Chunks = len(chunks)
+	return result, report, nil
+}
+
+// analyzeChunk 分析一段对话，内部分析器支持前文时单独传入上下文，否则拼接在本段之前
+func (a *ChunkedToneAnalyzer) analyzeChunk(ctx context.Context, chunk ToneChunk) ([]model.PreDialogue, error) {
+	// 复制为新切片，避免内部分析器修改调用方的数据
+	if contextual, ok := a.Analyzer.(ContextualToneAnalyzer); ok {
+		dialogues := append([]model.PreDialogue(nil), chunk.Dialogues...)
+		return contextual.AnalyzeWithContext(ctx, chunk.Context, dialogues)
+	}
+
+	input := make([]model.PreDialogue, 0, len(chunk.Context)+len(chunk.Dialogues))
+	input = append(input, chunk.Context...)
+	input = append(input, chunk.Dialogues...)
+	return a.Analyzer.Analyze(ctx, input)
+}
+
+// SplitToneChunks 按字符数和估算token数将对话分段，每段附带上一段末尾的若干条对话作为上下文
+func SplitToneChunks(dialogues []model.PreDialogue, config ChunkConfig) []ToneChunk {
+	config = config.withDefaults()
+
+	var chunks []ToneChunk
+	start, chars, tokens := 0, 0, 0
+	for i, d := range dialogues {
+		c, t := dialogueSize(d)
+		// 超出预算时另起一段，单条对话超出预算时独占一段
+		if i > start && (chars+c > config.MaxChars || tokens+t > config.MaxTokens) {
+			chunks = append(chunks, newToneChunk(dialogues, start, i, config.Overlap))
+			start, chars, tokens = i, 0, 0
+		}
+		chars += c
+		tokens += t
+	}
+	return append(chunks, newToneChunk(dialogues, start, len(dialogues), config.Overlap))
+}
+
+// newToneChunk 创建 dialogues[start:end] 的分段
+func newToneChunk(dialogues []model.PreDialogue, start, end, overlap int) ToneChunk {
+	contextStart := start - overlap
+	if contextStart < 0 {
+		contextStart = 0
+	}
+	return ToneChunk{
+		Context:   dialogues[contextStart:start],
+		Dialogues: dialogues[start:end],
+	}
+}
+
+// dialogueSize 按实际发送的JSON（toneQuery）计算对话的字符数和估算token数，包括数组中的逗号
+func dialogueSize(d model.PreDialogue) (chars, tokens int) {
+	// 请求中的序号不超过脚本行号，按行号估算不会低估
+	data, err := json.Marshal(newToneQuery(d.Step, d))
+	if err != nil {
+		return 0, 0
+	}
+	return utf8.RuneCount(data) + 1, EstimateTokens(string(data)) + 1
+}
+
+// EstimateTokens 粗略估算文本的token数：中日韩等非ASCII字符约1个token，ASCII约4个字符1个token
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4
+}
+
+// mergeToneChunks 将各段结果合并回本段对应的原对话，上下文对话的结果被忽略
+// 按 (来源文件, Step) 匹配，多个场景的对话 Step 重复时，无论是否在同一段都不会互相覆盖
+func mergeToneChunks(dialogues []model.PreDialogue, chunks []ToneChunk, results [][]model.PreDialogue) ([]model.PreDialogue, ToneReport) {
+	var report ToneReport
+	result := make([]model.PreDialogue, len(dialogues))
+	copy(result, dialogues)
+
+	offset := 0
+	for i, chunk := range chunks {
+		own := result[offset : offset+len(chunk.Dialogues)]
+		offset += len(chunk.Dialogues)
+		report.Updated += applyDialogueTones(own, results[i])
+	}
+
+	for _, d := range result {
+		if d.Tone == "" {
+			report.MissingSteps = append(report.MissingSteps, d.Step)
+		}
+	}
+	sort.Ints(report.MissingSteps)
+	return result, report
+}
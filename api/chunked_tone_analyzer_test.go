@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"myvoicego/model"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testDialogue 创建位于 file 第 step 行的对话
+func testDialogue(file string, step int, text string) model.PreDialogue {
+	return model.PreDialogue{
+		Step:   step,
+		Name:   "soyo",
+		Text:   text,
+		Source: &model.SourcePos{File: file, Line: step + 1},
+	}
+}
+
+func TestSplitToneChunks(t *testing.T) {
+	short := testDialogue("start.txt", 0, "短句")
+	long := testDialogue("start.txt", 0, "这是一句明显比其它对话长很多的台词，单独超过了每段的预算")
+	size, _ := dialogueSize(short)
+
+	repeat := func(d model.PreDialogue, n int) []model.PreDialogue {
+		dialogues := make([]model.PreDialogue, n)
+		for i := range dialogues {
+			dialogues[i] = d
+			dialogues[i].Step = i
+		}
+		return dialogues
+	}
+
+	tests := []struct {
+		name      string
+		dialogues []model.PreDialogue
+		config    ChunkConfig
+		sizes     []int // 每段需要分析的对话数
+		contexts  []int // 每段附带的上下文对话数
+	}{
+		{
+			name:      "不超出预算时只有一段",
+			dialogues: repeat(short, 3),
+			config:    ChunkConfig{MaxChars: size * 3, MaxTokens: 10000},
+			sizes:     []int{3},
+			contexts:  []int{0},
+		},
+		{
+			name:      "按字符数分段并附带上下文",
+			dialogues: repeat(short, 5),
+			config:    ChunkConfig{MaxChars: size * 2, MaxTokens: 10000, Overlap: 1},
+			sizes:     []int{2, 2, 1},
+			contexts:  []int{0, 1, 1},
+		},
+		{
+			name:      "上下文不超过前面的对话数",
+			dialogues: repeat(short, 3),
+			config:    ChunkConfig{MaxChars: size, MaxTokens: 10000, Overlap: 5},
+			sizes:     []int{1, 1, 1},
+			contexts:  []int{0, 1, 2},
+		},
+		{
+			name:      "按token数分段",
+			dialogues: repeat(short, 4),
+			config:    ChunkConfig{MaxChars: 100000, MaxTokens: 1},
+			sizes:     []int{1, 1, 1, 1},
+			contexts:  []int{0, 0, 0, 0},
+		},
+		{
+			name:      "超出预算的单条对话独占一段",
+			dialogues: []model.PreDialogue{short, long, short},
+			config:    ChunkConfig{MaxChars: size * 2, MaxTokens: 10000},
+			sizes:     []int{1, 1, 1},
+			contexts:  []int{0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitToneChunks(tt.dialogues, tt.config)
+			var sizes, contexts []int
+			for _, chunk := range chunks {
+				sizes = append(sizes, len(chunk.Dialogues))
+				contexts = append(contexts, len(chunk.Context))
+			}
+			if !reflect.DeepEqual(sizes, tt.sizes) || !reflect.DeepEqual(contexts, tt.contexts) {
+				t.Errorf("分段 = %v 上下文 %v, want %v 上下文 %v", sizes, contexts, tt.sizes, tt.contexts)
+			}
+		})
+	}
+}
+
+func TestChunkedToneAnalyzerMerge(t *testing.T) {
+	// 两个场景的对话行号相同，并且位于同一段中
+	dialogues := []model.PreDialogue{
+		testDialogue("start.txt", 1, "a"),
+		testDialogue("start.txt", 2, "b"),
+		testDialogue("chapter1.txt", 1, "c"),
+		testDialogue("chapter1.txt", 2, "d"),
+	}
+
+	tests := []struct {
+		name     string
+		analyzer ToneAnalyzerFunc
+		config   ChunkConfig
+		want     []string
+		missing  []int
+	}{
+		{
+			name: "倒序返回时按来源文件和行号合并",
+			analyzer: func(ctx context.Context, input []model.PreDialogue) ([]model.PreDialogue, error) {
+				result := make([]model.PreDialogue, 0, len(input))
+				for i := len(input) - 1; i >= 0; i-- {
+					d := input[i]
+					d.Tone = "tone-" + d.Text
+					result = append(result, d)
+				}
+				return result, nil
+			},
+			config: ChunkConfig{Disabled: true},
+			want:   []string{"tone-a", "tone-b", "tone-c", "tone-d"},
+		},
+		{
+			name: "分段时忽略上下文对话的结果",
+			analyzer: func(ctx context.Context, input []model.PreDialogue) ([]model.PreDialogue, error) {
+				result := append([]model.PreDialogue(nil), input...)
+				for i := range result {
+					result[i].Tone = "tone-" + result[i].Text + "-" + strconv.Itoa(len(input))
+				}
+				return result, nil
+			},
+			config: ChunkConfig{MaxChars: 1, MaxTokens: 10000, Overlap: 1, Concurrency: 1},
+			// 第一段没有上下文，其余各段附带一条上下文
+			want: []string{"tone-a-1", "tone-b-2", "tone-c-2", "tone-d-2"},
+		},
+		{
+			name: "缺少语气的对话记录在报告中",
+			analyzer: func(ctx context.Context, input []model.PreDialogue) ([]model.PreDialogue, error) {
+				result := append([]model.PreDialogue(nil), input...)
+				result[0].Tone = "normal"
+				return result, nil
+			},
+			config:  ChunkConfig{Disabled: true},
+			want:    []string{"normal", "", "", ""},
+			missing: []int{1, 2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyzer := NewChunkedToneAnalyzer(tt.analyzer, tt.config)
+			result, report, err := analyzer.AnalyzeWithReport(context.Background(), dialogues)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tones []string
+			for _, d := range result {
+				tones = append(tones, d.Tone)
+			}
+			if !reflect.DeepEqual(tones, tt.want) {
+				t.Errorf("tones = %v, want %v", tones, tt.want)
+			}
+			if !reflect.DeepEqual(report.MissingSteps, tt.missing) {
+				t.Errorf("MissingSteps = %v, want %v", report.MissingSteps, tt.missing)
+			}
+			for _, d := range dialogues {
+				if d.Tone != "" {
+					t.Fatalf("修改了调用方的对话: %+v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyQueryTones(t *testing.T) {
+	dialogues := []model.PreDialogue{
+		testDialogue("start.txt", 5, "a"),
+		testDialogue("chapter1.txt", 5, "b"),
+		testDialogue("chapter1.txt", 6, "c"),
+	}
+	tones := []StepTone{
+		{Step: 1, Tone: "sad"},
+		{Step: 0, Tone: "happy"},
+		{Step: 2, Tone: ""},      // 空语气不写入
+		{Step: 5, Tone: "angry"}, // 行号不是序号，越界被忽略
+		{Step: 0, Tone: "happy"}, // 重复的结果只计一次
+	}
+
+	updated := applyQueryTones(dialogues, tones)
+	if updated != 2 {
+		t.Errorf("updated = %d, want 2", updated)
+	}
+	var got []string
+	for _, d := range dialogues {
+		got = append(got, d.Tone)
+	}
+	if want := []string{"happy", "sad", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tones = %v, want %v", got, want)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Coze API特有常量
@@ -23,21 +25,71 @@ const (
 
 	// RoleUser 消息类型常量
 	RoleUser        = "user"
+	RoleAssistant   = "assistant"
+	TypeQuestion    = "question"
 	TypeToolOutput  = "tool_output"
 	ContentTypeText = "text"
 
 	// EventCompleted 事件类型常量
-	EventCompleted = "conversation.message.completed"
-	TypeAnswer     = "answer"
+	EventCompleted  = "conversation.message.completed"
+	EventDelta      = "conversation.message.delta"
+	EventChatFailed = "conversation.chat.failed"
+	EventError      = "error"
+	EventDone       = "done"
+	TypeAnswer      = "answer"
 )
 
+// StreamProgressFunc 流式响应的进度回调，delta 为新到达的内容，received 为本次请求已接收的字节数
+// 长脚本分段并发分析时各段分别计数，需要总进度时应累加 delta
+type StreamProgressFunc func(delta string, received int)
+
+// Coze 业务错误码
+const (
+	CozeCodeRateLimited  = 4013 // 请求频率超限
+	CozeCodeTokenInvalid = 4100 // 鉴权失败，token 无效或已过期
+	CozeCodeNoPermission = 4101 // token 没有访问该智能体的权限
+)
+
+// CozeError 表示 Coze 在响应中返回的业务错误
+type CozeError struct {
+	Event string // 出错的事件类型，非流式错误时为空
+	Code  int    `json:"code"`
+	Msg   string `json:"msg"`
+}
+
+// Error 实现 error 接口
+func (e *CozeError) Error() string {
+	if e.Event == "" {
+		return fmt.Sprintf("Coze 返回错误: code=%d, msg=%s", e.Code, e.Msg)
+	}
+	return fmt.Sprintf("Coze 返回错误 (%s): code=%d, msg=%s", e.Event, e.Code, e.Msg)
+}
+
+// Unwrap 将错误码归类为 ErrTokenInvalid、ErrRateLimited
+func (e *CozeError) Unwrap() error {
+	switch e.Code {
+	case CozeCodeTokenInvalid, CozeCodeNoPermission:
+		return ErrTokenInvalid
+	case CozeCodeRateLimited:
+		return ErrRateLimited
+	}
+	return nil
+}
+
 // CozeAPI 结构体用于封装 Coze API 的配置
 type CozeAPI struct {
-	BaseURL     string
-	BearerToken string
-	BotID       string
-	UserID      string
-	client      *http.Client // HTTP客户端，支持超时设置
+	BaseURL      string
+	BearerToken  string
+	BotID        string
+	UserID       string
+	Progress     StreamProgressFunc // 流式响应的进度回调，可为空；并发请求的回调串行执行
+	Personas     *PersonaBook       // 角色人设，可为空
+	Stream       bool               // 是否使用流式响应，关闭时创建对话后轮询结果
+	AutoSave     bool               // 是否在 Coze 中保存对话历史，非流式时必须开启
+	PollInterval time.Duration      // 非流式时轮询对话状态的间隔
+	Retry        RetryPolicy        // 请求失败时的重试策略
+	client       *http.Client       // HTTP客户端，支持超时设置
+	progressMu   sync.Mutex         // 串行化 Progress 回调
 }
 
 // NewCozeAPI 创建一个新的 CozeAPI 实例
@@ -47,6 +99,8 @@ func NewCozeAPI(bearerToken, botID, userID string) *CozeAPI {
 		BearerToken: bearerToken,
 		BotID:       botID,
 		UserID:      userID,
+		Retry:       DefaultRetryPolicy(),
+		Stream:      true,
 		client: &http.Client{
 			Timeout: RequestTimeout,
 		},
@@ -59,8 +113,8 @@ type Config struct {
 	Token           string `json:"token"`
 	BotID           string `json:"bot_id"`
 	UserID          string `json:"user_id"`
-	Stream          bool   `json:"stream"`
-	AutoSaveHistory bool   `json:"auto_save_history"`
+	Stream          bool   `json:"stream"`            // 关闭时使用创建对话、轮询状态、读取消息列表的非流式流程
+	AutoSaveHistory bool   `json:"auto_save_history"` // 非流式时 Coze 要求保存历史，总是视为开启
 }
 
 // NewCozeAPIFromConfig 从配置文件创建 CozeAPI 实例
@@ -93,6 +147,9 @@ func NewCozeAPIFromConfig(configPath string) (*CozeAPI, error) {
 		BearerToken: config.Token,
 		BotID:       config.BotID,
 		UserID:      config.UserID,
+		Retry:       DefaultRetryPolicy(),
+		Stream:      config.Stream,
+		AutoSave:    config.AutoSaveHistory,
 		client: &http.Client{
 			Timeout: RequestTimeout,
 		},
@@ -130,80 +187,155 @@ type Request struct {
 	UserID             string    `json:"user_id"`
 }
 
-// SendDialogueToCoze 发送对话内容到 Coze API 进行语气解析
-func (api *CozeAPI) SendDialogueToCoze(dialogueJSON string) ([]byte, error) {
+// SendDialogueToCoze 发送对话内容到 Coze API 进行语气解析，返回智能体的回答内容
+// ctx 取消时立即中断请求和流式读取
+func (api *CozeAPI) SendDialogueToCoze(ctx context.Context, dialogueJSON string) (string, error) {
 	// 验证输入
 	if dialogueJSON == "" {
-		return nil, fmt.Errorf("对话内容不能为空")
+		return "", fmt.Errorf("对话内容不能为空")
+	}
+	return api.SendMessages(ctx, []Message{newTextMessage(dialogueJSON)})
+}
+
+// newTextMessage 创建用户提问消息
+func newTextMessage(content string) Message {
+	return Message{
+		Role:        RoleUser,
+		Type:        TypeQuestion,
+		ContentType: ContentTypeText,
+		Content:     content,
 	}
+}
 
-	// 创建请求体
+// SendMessages 以多条消息发送给 Coze API，返回智能体的回答内容
+func (api *CozeAPI) SendMessages(ctx context.Context, messages []Message) (string, error) {
+	// 创建请求体，非流式时需要保存历史才能读取消息列表
 	req := Request{
-		BotID:           api.BotID,
-		Stream:          true,
-		AutoSaveHistory: false,
-		AdditionalMessages: []Message{
-			{
-				Role:        RoleUser,
-				Type:        TypeToolOutput,
-				ContentType: ContentTypeText,
-				Content:     dialogueJSON,
-			},
-		},
-		UserID: api.UserID,
+		BotID:              api.BotID,
+		Stream:             api.Stream,
+		AutoSaveHistory:    api.AutoSave || !api.Stream,
+		AdditionalMessages: messages,
+		UserID:             api.UserID,
 	}
 
 	// 将请求体转换为 JSON
 	reqBody, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("序列化请求失败: %v", err)
+		return "", fmt.Errorf("序列化请求失败: %v", err)
 	}
 
-	// 尝试最多3次请求
-	var body []byte
-	var resp *http.Response
-	for attempt := 1; attempt <= 3; attempt++ {
-		// 创建带上下文的 HTTP 请求，每次尝试都使用新的超时
-		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
-		defer cancel()
+	if !api.Stream {
+		return api.chatNonStream(ctx, reqBody)
+	}
 
-		httpReq, err := http.NewRequestWithContext(ctx, "POST", api.BaseURL, bytes.NewBuffer(reqBody))
+	resp, err := api.Retry.Do(ctx, api.client, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", api.BaseURL, bytes.NewReader(reqBody))
 		if err != nil {
-			return nil, fmt.Errorf("创建请求失败: %v", err)
+			return nil, err
 		}
 
 		// 设置请求头
 		httpReq.Header.Set(HeaderAuth, "Bearer "+api.BearerToken)
 		httpReq.Header.Set(HeaderContentType, ContentTypeJSON)
+		return httpReq, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// 鉴权失败等错误以普通 JSON 而不是事件流返回
+	if strings.HasPrefix(resp.Header.Get(HeaderContentType), ContentTypeJSON) {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+		if err != nil {
+			return "", fmt.Errorf("读取响应失败: %v", err)
+		}
+		return "", parseCozeError("", string(body))
+	}
+
+	return api.readChatStream(resp.Body)
+}
+
+// reportProgress 调用进度回调，分段并发分析时多个请求共用同一个回调，因此加锁串行执行
+func (api *CozeAPI) reportProgress(delta string, received int) {
+	if api.Progress == nil {
+		return
+	}
+	api.progressMu.Lock()
+	defer api.progressMu.Unlock()
+	api.Progress(delta, received)
+}
+
+// readChatStream 增量读取流式响应，累积回答内容并在出错事件时返回 CozeError
+func (api *CozeAPI) readChatStream(body io.Reader) (string, error) {
+	reader := NewSSEReader(body)
 
-		// 发送请求
-		resp, err = api.client.Do(httpReq)
+	var answer strings.Builder
+	var completed string
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			if attempt < 3 {
-				fmt.Printf("请求失败 (尝试 %d/3): %v，正在重试...\n", attempt, err)
+			return "", fmt.Errorf("读取流式响应失败: %w", err)
+		}
+
+		switch event.Event {
+		case EventDelta:
+			delta, err := parseDataContent(event.Data)
+			if err != nil {
 				continue
 			}
-			return nil, fmt.Errorf("发送请求失败: %v", err)
+			answer.WriteString(delta)
+			api.reportProgress(delta, answer.Len())
+		case EventCompleted:
+			content, err := parseDataContent(event.Data)
+			if err == nil && content != "" {
+				completed = content
+			}
+		case EventChatFailed:
+			return "", parseChatFailed(event.Data)
+		case EventError:
+			return "", parseCozeError(EventError, event.Data)
+		case EventDone:
+			return finalAnswer(completed, answer.String())
 		}
-
-		// 请求成功，跳出循环
-		break
 	}
-	defer resp.Body.Close()
 
-	// 限制响应体大小
-	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
-	body, err = io.ReadAll(limitedReader)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %v", err)
+	return finalAnswer(completed, answer.String())
+}
+
+// finalAnswer 优先使用完整消息，没有完整消息时使用累积的增量内容
+func finalAnswer(completed, accumulated string) (string, error) {
+	if completed != "" {
+		return completed, nil
+	}
+	if accumulated != "" {
+		return accumulated, nil
 	}
+	return "", fmt.Errorf("未找到有效的情绪分析结果")
+}
 
-	// 检查响应状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+// parseChatFailed 解析 conversation.chat.failed 事件中的 last_error
+func parseChatFailed(dataStr string) error {
+	var chat struct {
+		LastError CozeError `json:"last_error"`
+	}
+	if err := json.Unmarshal([]byte(dataStr), &chat); err != nil {
+		return &CozeError{Event: EventChatFailed, Msg: dataStr}
 	}
+	chat.LastError.Event = EventChatFailed
+	return &chat.LastError
+}
 
-	return body, nil
+// parseCozeError 解析 error 事件或非流式的错误响应
+func parseCozeError(event, dataStr string) error {
+	cozeErr := CozeError{Event: event}
+	if err := json.Unmarshal([]byte(dataStr), &cozeErr); err != nil {
+		cozeErr.Msg = dataStr
+	}
+	return &cozeErr
 }
 
 // ReadDialogueFromFile 从指定目录读取对话文件
@@ -282,15 +414,35 @@ type ToneResult struct {
 	Tone  string `json:"tone"`
 }
 
-// AnalyzeTones 分析对话的语气
-func (api *CozeAPI) AnalyzeTones(dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+// Analyze 实现 ToneAnalyzer 接口
+func (api *CozeAPI) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	return api.AnalyzeTones(ctx, nil, dialogues)
+}
+
+// AnalyzeWithContext 实现 ContextualToneAnalyzer 接口
+func (api *CozeAPI) AnalyzeWithContext(ctx context.Context, preceding, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	return api.AnalyzeTones(ctx, preceding, dialogues)
+}
+
+// AnalyzeWithTones 实现 ToneHintAnalyzer 接口，每句台词附带可选的语气，用于重新询问
+func (api *CozeAPI) AnalyzeWithTones(ctx context.Context, dialogues []model.PreDialogue, tones [][]string) ([]model.PreDialogue, error) {
+	return api.analyzeTones(ctx, nil, dialogues, tones)
+}
+
+// AnalyzeTones 分析对话的语气，人设、场景和前文 preceding 作为单独的消息放在对话之前
+func (api *CozeAPI) AnalyzeTones(ctx context.Context, preceding, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	return api.analyzeTones(ctx, preceding, dialogues, nil)
+}
+
+// analyzeTones 分析对话的语气，tones 不为空时要求模型只从每句列出的语气中选择
+func (api *CozeAPI) analyzeTones(ctx context.Context, preceding, dialogues []model.PreDialogue, tones [][]string) ([]model.PreDialogue, error) {
 	// 验证输入
 	if len(dialogues) == 0 {
 		return nil, fmt.Errorf("对话列表不能为空")
 	}
 
-	// 将对话转换为JSON
-	dialogueJSON, err := json.Marshal(dialogues)
+	// 将对话转换为JSON，只发送判断语气需要的字段
+	dialogueJSON, err := json.Marshal(newToneQueries(dialogues, tones))
 	if err != nil {
 		return nil, fmt.Errorf("序列化对话失败: %v", err)
 	}
@@ -298,20 +450,20 @@ func (api *CozeAPI) AnalyzeTones(dialogues []model.PreDialogue) ([]model.PreDial
 	// 记录请求开始时间
 	fmt.Printf("开始发送情绪分析请求，对话数量: %d\n", len(dialogues))
 
-	// 发送请求到Coze API
-	response, err := api.SendDialogueToCoze(string(dialogueJSON))
-	if err != nil {
-		return nil, fmt.Errorf("发送情绪分析请求失败: %v", err)
+	// 上下文消息在前，待分析的对话在最后
+	var messages []Message
+	for _, content := range buildContextMessages(api.Personas, preceding, dialogues) {
+		messages = append(messages, newTextMessage(content))
 	}
+	if tones != nil {
+		messages = append(messages, newTextMessage(toneReaskMessage))
+	}
+	messages = append(messages, newTextMessage(string(dialogueJSON)))
 
-	// 解析流式响应
-	responseStr := string(response)
-	lines := strings.Split(responseStr, "\n")
-
-	// 查找最终结果
-	finalContent, err := extractFinalContent(lines)
+	// 发送请求到Coze API
+	finalContent, err := api.SendMessages(ctx, messages)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("发送情绪分析请求失败: %w", err)
 	}
 
 	// 首先尝试解析为数组
@@ -326,59 +478,20 @@ func (api *CozeAPI) AnalyzeTones(dialogues []model.PreDialogue) ([]model.PreDial
 		toneDialogues = []model.PreDialogue{singleToneDialogue}
 	}
 
-	// 创建step到tone的映射
-	stepToTone := make(map[int]string, len(toneDialogues))
+	// 返回结果中的 step 是对话在请求中的序号
+	stepTones := make([]StepTone, 0, len(toneDialogues))
 	for _, dialogue := range toneDialogues {
-		if dialogue.Tone != "" {
-			stepToTone[dialogue.Step] = dialogue.Tone
-		}
+		stepTones = append(stepTones, StepTone{Step: dialogue.Step, Tone: dialogue.Tone})
 	}
 
-	// 更新原始对话的语气
-	updatedCount := 0
-	for i := range dialogues {
-		if tone, exists := stepToTone[dialogues[i].Step]; exists {
-			dialogues[i].Tone = tone
-			updatedCount++
-		}
-	}
-
-	fmt.Printf("情绪分析完成，更新了 %d/%d 条对话的语气\n", updatedCount, len(dialogues))
-
-	return dialogues, nil
-}
-
-// extractFinalContent 从流式响应中提取最终内容
-func extractFinalContent(lines []string) (string, error) {
-	for i, line := range lines {
-		if !strings.HasPrefix(line, "event:") {
-			continue
-		}
-
-		event := strings.TrimSpace(strings.TrimPrefix(line, "event:"))
-		if event != EventCompleted {
-			continue
-		}
-
-		if i+1 >= len(lines) {
-			continue
-		}
-
-		nextLine := lines[i+1]
-		if !strings.HasPrefix(nextLine, "data:") {
-			continue
-		}
+	// 复制为新切片后更新语气，不修改调用方的数据
+	result := make([]model.PreDialogue, len(dialogues))
+	copy(result, dialogues)
+	updatedCount := applyQueryTones(result, stepTones)
 
-		dataStr := strings.TrimSpace(strings.TrimPrefix(nextLine, "data:"))
-		content, err := parseDataContent(dataStr)
-		if err != nil {
-			continue
-		}
+	fmt.Printf("情绪分析完成，更新了 %d/%d 条对话的语气\n", updatedCount, len(result))
 
-		return content, nil
-	}
-
-	return "", fmt.Errorf("未找到有效的情绪分析结果")
+	return result, nil
 }
 
 // parseDataContent 解析数据内容
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 非流式对话相关常量
+const (
+	CozeRetrievePath    = "/retrieve"
+	CozeMessageListPath = "/message/list"
+
+	// DefaultPollInterval 轮询对话状态的默认间隔
+	DefaultPollInterval = time.Second
+
+	// 对话状态
+	ChatStatusCreated        = "created"
+	ChatStatusInProgress     = "in_progress"
+	ChatStatusCompleted      = "completed"
+	ChatStatusFailed         = "failed"
+	ChatStatusRequiresAction = "requires_action"
+	ChatStatusCanceled       = "canceled"
+)
+
+// CozeChat 表示 Coze 的一次对话
+type CozeChat struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	Status         string    `json:"status"`
+	LastError      CozeError `json:"last_error"`
+}
+
+// CozeMessage 表示对话中的一条消息
+type CozeMessage struct {
+	Role        string `json:"role"`
+	Type        string `json:"type"`
+	Content     string `json:"content"`
+	ContentType string `json:"content_type"`
+}
+
+// cozeResponse 表示 Coze 非流式接口的通用响应
+type cozeResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// chatNonStream 创建对话后轮询状态，完成后读取消息列表中的回答
+func (api *CozeAPI) chatNonStream(ctx context.Context, reqBody []byte) (string, error) {
+	var chat CozeChat
+	if err := api.cozeCall(ctx, "POST", api.BaseURL, reqBody, &chat); err != nil {
+		return "", err
+	}
+
+	interval := api.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	query := url.Values{}
+	query.Set("conversation_id", chat.ConversationID)
+	query.Set("chat_id", chat.ID)
+
+	// 轮询总时长与流式请求的超时一致
+	deadline := time.Now().Add(RequestTimeout)
+	for chat.Status != ChatStatusCompleted {
+		switch chat.Status {
+		case ChatStatusFailed:
+			chat.LastError.Event = ChatStatusFailed
+			return "", &chat.LastError
+		case ChatStatusCanceled, ChatStatusRequiresAction:
+			return "", fmt.Errorf("对话未完成，状态: %s", chat.Status)
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("等待对话完成超时，状态: %s", chat.Status)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+
+		if err := api.cozeCall(ctx, "GET", api.BaseURL+CozeRetrievePath+"?"+query.Encode(), nil, &chat); err != nil {
+			return "", fmt.Errorf("查询对话状态失败: %w", err)
+		}
+	}
+
+	var messages []CozeMessage
+	if err := api.cozeCall(ctx, "GET", api.BaseURL+CozeMessageListPath+"?"+query.Encode(), nil, &messages); err != nil {
+		return "", fmt.Errorf("获取消息列表失败: %w", err)
+	}
+
+	for _, message := range messages {
+		if message.Role == RoleAssistant && message.Type == TypeAnswer && message.Content != "" {
+			return message.Content, nil
+		}
+	}
+	return "", fmt.Errorf("未找到有效的情绪分析结果")
+}
+
+// cozeCall 发送非流式请求，code 不为0时返回 CozeError，否则将 data 解析到 out
+func (api *CozeAPI) cozeCall(ctx context.Context, method, rawURL string, reqBody []byte, out interface{}) error {
+	resp, err := api.Retry.Do(ctx, api.client, func(ctx context.Context) (*http.Request, error) {
+		var body io.Reader
+		if reqBody != nil {
+			body = bytes.NewReader(reqBody)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set(HeaderAuth, "Bearer "+api.BearerToken)
+		httpReq.Header.Set(HeaderContentType, ContentTypeJSON)
+		return httpReq, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	var result cozeResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("解析响应失败: %v", err)
+	}
+	if result.Code != 0 {
+		return &CozeError{Code: result.Code, Msg: result.Msg}
+	}
+	if err := json.Unmarshal(result.Data, out); err != nil {
+		return fmt.Errorf("解析响应数据失败: %v", err)
+	}
+	return nil
+}
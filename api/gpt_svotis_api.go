@@ -2,55 +2,159 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"myvoicego/model"
+	"myvoicego/utils"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // TTS API特有常量
 const (
-	// TTS API URLs
-	DefaultTTSURL           = "http://127.0.0.1:9880/tts"
-	DefaultSoVITSWeightsURL = "http://127.0.0.1:9880/set_sovits_weights"
-	DefaultGPTWeightsURL    = "http://127.0.0.1:9880/set_gpt_weights"
+	// TTS API 路径，完整地址为 BaseURL + 路径
+	TTSPath           = "/tts"
+	SoVITSWeightsPath = "/set_sovits_weights"
+	GPTWeightsPath    = "/set_gpt_weights"
+	ReferAudioPath    = "/set_refer_audio"
+	ControlPath       = "/control"
+
+	// /control 支持的命令
+	ControlRestart = "restart"
+	ControlExit    = "exit"
 )
 
+// GSVError 表示 GPT-SoVITS 返回的错误，响应体为 {"message": ..., "Exception": ...}
+type GSVError struct {
+	StatusCode int
+	model.APIError
+}
+
+// Error 实现 error 接口
+func (e *GSVError) Error() string {
+	if e.Exception != "" {
+		return fmt.Sprintf("GPT-SoVITS 返回错误 (状态码 %d): %s: %s", e.StatusCode, e.Message, e.Exception)
+	}
+	return fmt.Sprintf("GPT-SoVITS 返回错误 (状态码 %d): %s", e.StatusCode, e.Message)
+}
+
+// Unwrap 与 HTTPError 一样按状态码归类
+func (e *GSVError) Unwrap() error {
+	return (&HTTPError{StatusCode: e.StatusCode}).Unwrap()
+}
+
+// newGSVError 解析错误响应，无法解析为 APIError 时返回 *HTTPError
+func newGSVError(resp *http.Response) error {
+	httpErr := newHTTPError(resp)
+	var apiErr model.APIError
+	if err := json.Unmarshal([]byte(httpErr.Body), &apiErr); err != nil || apiErr.Message == "" {
+		return httpErr
+	}
+	return &GSVError{StatusCode: httpErr.StatusCode, APIError: apiErr}
+}
+
 // GPTSvotisAPI 结构体用于封装 TTS API 的配置
 type GPTSvotisAPI struct {
 	TTSURL           string
 	SoVITSWeightsURL string
 	GPTWeightsURL    string
+	ReferAudioURL    string
+	ControlURL       string
 	client           *http.Client // HTTP客户端，支持超时设置
+	streamClient     *http.Client // 流式输出使用，只限制等待响应头的时间，整体由 ctx 控制
 }
 
-// NewGPTSvotisAPI 创建一个新的 GPTSvotisAPI 实例
+// NewGPTSvotisAPI 创建一个使用默认地址 127.0.0.1:9880 的 GPTSvotisAPI 实例
 func NewGPTSvotisAPI() *GPTSvotisAPI {
+	config := utils.GSVConfig{Host: utils.DefaultGSVHost, Port: utils.DefaultGSVPort}
+	return NewGPTSvotisAPIWithBaseURL(config.BaseURL(), RequestTimeout)
+}
+
+// NewGPTSvotisAPIWithBaseURL 使用指定的服务地址（如 http://127.0.0.1:9880）和超时创建实例
+func NewGPTSvotisAPIWithBaseURL(baseURL string, timeout time.Duration) *GPTSvotisAPI {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if timeout <= 0 {
+		timeout = RequestTimeout
+	}
 	return &GPTSvotisAPI{
-		TTSURL:           DefaultTTSURL,
-		SoVITSWeightsURL: DefaultSoVITSWeightsURL,
-		GPTWeightsURL:    DefaultGPTWeightsURL,
+		TTSURL:           baseURL + TTSPath,
+		SoVITSWeightsURL: baseURL + SoVITSWeightsPath,
+		GPTWeightsURL:    baseURL + GPTWeightsPath,
+		ReferAudioURL:    baseURL + ReferAudioPath,
+		ControlURL:       baseURL + ControlPath,
 		client: &http.Client{
-			Timeout: RequestTimeout,
+			Timeout: timeout,
+		},
+		streamClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: timeout,
+			},
 		},
 	}
 }
 
-// GenerateTTS 生成TTS语音
-func (api *GPTSvotisAPI) GenerateTTS(req model.TTSRequest) ([]byte, error) {
-	// 验证输入
+// NewGPTSvotisAPIFromConfig 从 gpt_svotis_path.json 读取服务地址和超时创建实例，
+// 与 utils.StartGPTSvits 启动服务时使用同一份配置
+func NewGPTSvotisAPIFromConfig(configPath string) (*GPTSvotisAPI, error) {
+	config, err := utils.LoadGSVConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewGPTSvotisAPIWithBaseURL(config.BaseURL(), time.Duration(config.Timeout)*time.Second), nil
+}
+
+// GenerateTTS 生成TTS语音，ctx 取消时中断请求
+// 音频整体读入内存，超过 MaxResponseSize 时返回错误，较长的语音请使用 SaveTTS 或 GenerateTTSStream
+func (api *GPTSvotisAPI) GenerateTTS(ctx context.Context, req model.TTSRequest) ([]byte, error) {
+	resp, err := api.postTTS(ctx, api.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// 多读一个字节，用于判断响应是否超出大小限制
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if len(body) > MaxResponseSize {
+		return nil, fmt.Errorf("音频超过 %d 字节，请改用流式输出", MaxResponseSize)
+	}
+
+	return body, nil
+}
+
+// validateTTSRequest 检查TTS请求的必需参数
+func validateTTSRequest(req model.TTSRequest) error {
 	if req.Text == "" {
-		return nil, fmt.Errorf("文本内容不能为空")
+		return fmt.Errorf("文本内容不能为空")
 	}
 	if req.TextLang == "" {
-		return nil, fmt.Errorf("文本语言不能为空")
+		return fmt.Errorf("文本语言不能为空")
 	}
 	if req.RefAudioPath == "" {
-		return nil, fmt.Errorf("参考音频路径不能为空")
+		return fmt.Errorf("参考音频路径不能为空")
 	}
 	if req.PromptLang == "" {
-		return nil, fmt.Errorf("提示文本语言不能为空")
+		return fmt.Errorf("提示文本语言不能为空")
+	}
+	return nil
+}
+
+// postTTS 发送TTS请求，状态码为200时返回响应，由调用方关闭响应体
+func (api *GPTSvotisAPI) postTTS(ctx context.Context, client *http.Client, req model.TTSRequest) (*http.Response, error) {
+	// 验证输入
+	if err := validateTTSRequest(req); err != nil {
+		return nil, err
 	}
 
 	// 将请求体转换为 JSON
@@ -60,7 +164,7 @@ func (api *GPTSvotisAPI) GenerateTTS(req model.TTSRequest) ([]byte, error) {
 	}
 
 	// 创建 HTTP 请求
-	httpReq, err := http.NewRequest("POST", api.TTSURL, bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", api.TTSURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
@@ -69,77 +173,181 @@ func (api *GPTSvotisAPI) GenerateTTS(req model.TTSRequest) ([]byte, error) {
 	httpReq.Header.Set(HeaderContentType, ContentTypeJSON)
 
 	// 发送请求
-	resp, err := api.client.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 限制响应体大小
-	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
-	body, err := io.ReadAll(limitedReader)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %v", err)
+		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
 
 	// 检查响应状态码
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		return nil, newGSVError(resp)
 	}
 
-	return body, nil
+	return resp, nil
 }
 
 // SetSoVITSWeights 设置SoVITS模型权重
-func (api *GPTSvotisAPI) SetSoVITSWeights(weightsPath string) ([]byte, error) {
+func (api *GPTSvotisAPI) SetSoVITSWeights(ctx context.Context, weightsPath string) ([]byte, error) {
 	// 验证输入
 	if weightsPath == "" {
 		return nil, fmt.Errorf("权重路径不能为空")
 	}
 
-	// 构建请求URL
-	url := fmt.Sprintf("%s?weights_path=%s", api.SoVITSWeightsURL, weightsPath)
+	// 构建请求URL，路径中的空格、& 和中文需要转义
+	query, err := requestQuery(model.SetSoVITSWeightsRequest{WeightsPath: weightsPath})
+	if err != nil {
+		return nil, err
+	}
+	return api.get(ctx, withQuery(api.SoVITSWeightsURL, query))
+}
 
-	// 创建 HTTP 请求
-	httpReq, err := http.NewRequest("GET", url, nil)
+// SetGPTWeights 设置GPT模型权重
+func (api *GPTSvotisAPI) SetGPTWeights(ctx context.Context, weightsPath string) ([]byte, error) {
+	// 验证输入
+	if weightsPath == "" {
+		return nil, fmt.Errorf("权重路径不能为空")
+	}
+
+	// 构建请求URL，路径中的空格、& 和中文需要转义
+	query, err := requestQuery(model.SetGPTWeightsRequest{WeightsPath: weightsPath})
 	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
+		return nil, err
 	}
+	return api.get(ctx, withQuery(api.GPTWeightsURL, query))
+}
 
-	// 发送请求
-	resp, err := api.client.Do(httpReq)
+// SetReferAudio 设置服务端默认的参考音频
+func (api *GPTSvotisAPI) SetReferAudio(ctx context.Context, referAudioPath string) ([]byte, error) {
+	// 验证输入
+	if referAudioPath == "" {
+		return nil, fmt.Errorf("参考音频路径不能为空")
+	}
+
+	query, err := requestQuery(model.SetReferAudioRequest{ReferAudioPath: referAudioPath})
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return api.get(ctx, withQuery(api.ReferAudioURL, query))
+}
+
+// Restart 重启 GPT-SoVITS 服务，服务重启期间的请求会失败
+func (api *GPTSvotisAPI) Restart(ctx context.Context) error {
+	return api.control(ctx, ControlRestart)
+}
 
-	// 限制响应体大小
-	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
-	body, err := io.ReadAll(limitedReader)
+// Exit 关闭 GPT-SoVITS 服务
+func (api *GPTSvotisAPI) Exit(ctx context.Context) error {
+	return api.control(ctx, ControlExit)
+}
+
+// control 发送控制命令，服务端执行命令时直接退出进程，连接被断开或重置视为成功
+func (api *GPTSvotisAPI) control(ctx context.Context, command string) error {
+	query, err := requestQuery(model.ControlRequest{Command: command})
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %v", err)
+		return err
+	}
+	_, err = api.get(ctx, withQuery(api.ControlURL, query))
+	if err != nil && ctx.Err() == nil && isConnectionDropped(err) {
+		return nil
 	}
+	return err
+}
 
-	// 检查响应状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+// wsaECONNRESET Windows 上的连接重置错误码，syscall.ECONNRESET 在 Windows 上不对应该错误码
+const wsaECONNRESET syscall.Errno = 10054
+
+// isConnectionDropped 判断请求发出后连接是否被对端断开（EOF 或连接重置），超时不算断开
+func isConnectionDropped(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
 	}
+	var errno syscall.Errno
+	return errors.As(err, &errno) && errno == wsaECONNRESET
+}
 
+// GenerateTTSGet 通过 GET /tts 生成语音，参数放在查询字符串中，适合调试或只支持 GET 的调用方
+func (api *GPTSvotisAPI) GenerateTTSGet(ctx context.Context, req model.TTSRequest) ([]byte, error) {
+	if err := validateTTSRequest(req); err != nil {
+		return nil, err
+	}
+	body, err := api.get(ctx, withQuery(api.TTSURL, ttsQuery(req)))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxResponseSize {
+		return nil, fmt.Errorf("音频超过 %d 字节，请改用流式输出", MaxResponseSize)
+	}
 	return body, nil
 }
 
-// SetGPTWeights 设置GPT模型权重
-func (api *GPTSvotisAPI) SetGPTWeights(weightsPath string) ([]byte, error) {
-	// 验证输入
-	if weightsPath == "" {
-		return nil, fmt.Errorf("权重路径不能为空")
+// ttsQuery 将TTS请求转换为 GET /tts 的查询参数，参数名与JSON字段一致
+func ttsQuery(req model.TTSRequest) url.Values {
+	query := url.Values{}
+	query.Set("text", req.Text)
+	query.Set("text_lang", req.TextLang)
+	query.Set("ref_audio_path", req.RefAudioPath)
+	for _, path := range req.AuxRefAudioPaths {
+		query.Add("aux_ref_audio_paths", path)
 	}
+	query.Set("prompt_text", req.PromptText)
+	query.Set("prompt_lang", req.PromptLang)
+	query.Set("top_k", strconv.Itoa(req.TopK))
+	query.Set("top_p", formatFloat(req.TopP))
+	query.Set("temperature", formatFloat(req.Temperature))
+	query.Set("text_split_method", req.TextSplitMethod)
+	query.Set("batch_size", strconv.Itoa(req.BatchSize))
+	query.Set("batch_threshold", formatFloat(req.BatchThreshold))
+	query.Set("split_bucket", strconv.FormatBool(req.SplitBucket))
+	query.Set("speed_factor", formatFloat(req.SpeedFactor))
+	query.Set("fragment_interval", formatFloat(req.FragmentInterval))
+	query.Set("seed", strconv.Itoa(req.Seed))
+	query.Set("media_type", req.MediaType)
+	query.Set("streaming_mode", strconv.FormatBool(req.StreamingMode))
+	query.Set("parallel_infer", strconv.FormatBool(req.ParallelInfer))
+	query.Set("repetition_penalty", formatFloat(req.RepetitionPenalty))
+	query.Set("sample_steps", strconv.Itoa(req.SampleSteps))
+	query.Set("super_sampling", strconv.FormatBool(req.SuperSampling))
+	return query
+}
 
-	// 构建请求URL
-	url := fmt.Sprintf("%s?weights_path=%s", api.GPTWeightsURL, weightsPath)
+// requestQuery 按请求结构体的 json 标签生成查询参数，结构体字段须均为字符串
+func requestQuery(req interface{}) (url.Values, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+	var fields map[string]string
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("生成查询参数失败: %v", err)
+	}
+	query := url.Values{}
+	for key, value := range fields {
+		query.Set(key, value)
+	}
+	return query, nil
+}
 
+// withQuery 在地址后附加编码后的查询参数，地址中已有参数时以 & 连接
+func withQuery(rawURL string, query url.Values) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query.Encode()
+	}
+	return rawURL + "?" + query.Encode()
+}
+
+// formatFloat 格式化浮点参数，使用最短表示
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// get 发送 GET 请求并读取响应，非200状态码时返回 *GSVError 或 *HTTPError
+func (api *GPTSvotisAPI) get(ctx context.Context, rawURL string) ([]byte, error) {
 	// 创建 HTTP 请求
-	httpReq, err := http.NewRequest("GET", url, nil)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
@@ -147,20 +355,19 @@ func (api *GPTSvotisAPI) SetGPTWeights(weightsPath string) ([]byte, error) {
 	// 发送请求
 	resp, err := api.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 限制响应体大小
-	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
-	body, err := io.ReadAll(limitedReader)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %v", err)
+		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
 
 	// 检查响应状态码
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		return nil, newGSVError(resp)
+	}
+	defer resp.Body.Close()
+
+	// 多读一个字节，调用方可据此判断响应是否超出大小限制
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	return body, nil
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIsConnectionDropped(t *testing.T) {
+	// readErr 模拟 http.Client 返回的读取阶段错误
+	readErr := func(err error) error {
+		opErr := &net.OpError{Op: "read", Net: "tcp", Err: err}
+		return fmt.Errorf("发送请求失败: %w", &url.Error{Op: "Get", URL: "http://127.0.0.1:9880/control", Err: opErr})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "EOF", err: fmt.Errorf("发送请求失败: %w", &url.Error{Op: "Get", Err: io.EOF}), want: true},
+		{name: "读取响应时EOF", err: fmt.Errorf("读取响应失败: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "连接重置", err: readErr(os.NewSyscallError("read", syscall.ECONNRESET)), want: true},
+		{name: "Windows连接重置", err: readErr(os.NewSyscallError("wsarecv", wsaECONNRESET)), want: true},
+		{name: "读取超时", err: readErr(os.ErrDeadlineExceeded)},
+		{name: "连接被拒绝", err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}},
+		{name: "读取阶段的其它网络错误", err: readErr(os.NewSyscallError("read", syscall.ENETUNREACH))},
+		{name: "普通错误", err: errors.New("服务返回错误")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConnectionDropped(tt.err); got != tt.want {
+				t.Errorf("isConnectionDropped(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// OpenAI 兼容接口常量
+const (
+	// DefaultOpenAIBaseURL 默认的接口地址，本地模型可改为 http://127.0.0.1:11434/v1 等
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	OpenAIChatPath       = "/chat/completions"
+
+	// RoleSystem 消息角色常量
+	RoleSystem = "system"
+
+	// TonesPlaceholder 系统提示词中可用语气列表的占位符
+	TonesPlaceholder = "{{tones}}"
+)
+
+// DefaultOpenAISystemPrompt 默认的系统提示词
+const DefaultOpenAISystemPrompt = `你是视觉小说的配音导演。用户会给出一组台词，每句包含序号 step、说话人 name、文本 text，以及立绘的表情 expression 和动作 motion。
+请结合上下文、表情和动作判断每句台词的语气，语气只能从该角色可用的语气中选择：
+` + TonesPlaceholder + `
+只输出JSON，格式为 {"tones": [{"step": 台词的step, "tone": "语气"}]}，不要输出其它内容。`
+
+// OpenAIAPI 结构体用于封装 OpenAI 兼容的 /v1/chat/completions 接口
+type OpenAIAPI struct {
+	BaseURL      string
+	APIKey       string
+	Model        string
+	SystemPrompt string
+	JSONMode     bool         // 是否请求 response_format=json_object
+	Temperature  float64      // 采样温度
+	Retry        RetryPolicy  // 请求失败时的重试策略
+	Personas     *PersonaBook // 角色人设，可为空
+	tones        string       // 嵌入系统提示词的可用语气列表
+	client       *http.Client
+}
+
+// NewOpenAIAPI 创建一个新的 OpenAIAPI 实例
+func NewOpenAIAPI(baseURL, apiKey, modelName string) *OpenAIAPI {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAIAPI{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		APIKey:       apiKey,
+		Model:        modelName,
+		SystemPrompt: DefaultOpenAISystemPrompt,
+		JSONMode:     true,
+		Retry:        DefaultRetryPolicy(),
+		client: &http.Client{
+			Timeout: RequestTimeout,
+		},
+	}
+}
+
+// OpenAIConfig 表示 OpenAI 兼容接口的配置结构
+type OpenAIConfig struct {
+	BaseURL      string   `json:"base_url"`
+	APIKey       string   `json:"api_key"`
+	Model        string   `json:"model"`
+	SystemPrompt string   `json:"system_prompt"` // 为空时使用默认提示词，可包含 {{tones}} 占位符
+	JSONMode     *bool    `json:"json_mode"`     // 默认开启，不支持JSON模式的模型可关闭
+	Temperature  *float64 `json:"temperature"`
+}
+
+// NewOpenAIAPIFromConfig 从配置文件创建 OpenAIAPI 实例，可用语气由调用方通过 SetAvailableTones 设置
+func NewOpenAIAPIFromConfig(configPath string) (*OpenAIAPI, error) {
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var config OpenAIConfig
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	if config.Model == "" {
+		return nil, fmt.Errorf("配置验证失败: model 不能为空")
+	}
+
+	api := NewOpenAIAPI(config.BaseURL, config.APIKey, config.Model)
+	if config.SystemPrompt != "" {
+		api.SystemPrompt = config.SystemPrompt
+	}
+	if config.JSONMode != nil {
+		api.JSONMode = *config.JSONMode
+	}
+	if config.Temperature != nil {
+		api.Temperature = *config.Temperature
+	}
+
+	return api, nil
+}
+
+// SetAvailableTones 根据参考音频列表设置提示词中的可用语气
+func (api *OpenAIAPI) SetAvailableTones(refs []utils.AudioRefModel) {
+	var sb strings.Builder
+	for _, ref := range refs {
+		for _, subDir := range ref.SubDirs {
+			if len(subDir.Tones) == 0 {
+				continue
+			}
+			name := ref.Model
+			if subDir.AudioId != "" {
+				name += "/" + subDir.AudioId
+			}
+			tones := make([]string, 0, len(subDir.Tones))
+			for _, tone := range subDir.Tones {
+				tones = append(tones, tone.Tone)
+			}
+			sort.Strings(tones)
+			fmt.Fprintf(&sb, "- %s: %s\n", name, strings.Join(tones, ", "))
+		}
+	}
+	api.tones = strings.TrimRight(sb.String(), "\n")
+}
+
+// systemPrompt 生成嵌入了可用语气的系统提示词
+func (api *OpenAIAPI) systemPrompt() string {
+	tones := api.tones
+	if tones == "" {
+		tones = "（未提供参考音频列表，请使用简短的中文情绪词）"
+	}
+	if strings.Contains(api.SystemPrompt, TonesPlaceholder) {
+		return strings.ReplaceAll(api.SystemPrompt, TonesPlaceholder, tones)
+	}
+	return api.SystemPrompt + "\n可用语气：\n" + tones
+}
+
+// ChatMessage 表示 chat/completions 的一条消息
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ResponseFormat 表示结构化输出格式
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// ChatRequest 表示 chat/completions 请求
+type ChatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	Temperature    float64         `json:"temperature"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ChatResponse 表示 chat/completions 响应
+type ChatResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// StepTone 表示模型按 step（对话在请求中的序号）返回的语气
+type StepTone struct {
+	Step int    `json:"step"`
+	Tone string `json:"tone"`
+}
+
+// Analyze 实现 ToneAnalyzer 接口
+func (api *OpenAIAPI) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	return api.AnalyzeWithContext(ctx, nil, dialogues)
+}
+
+// AnalyzeWithContext 实现 ContextualToneAnalyzer 接口，人设、场景和前文作为单独的消息放在对话之前
+func (api *OpenAIAPI) AnalyzeWithContext(ctx context.Context, preceding, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	return api.analyzeTones(ctx, preceding, dialogues, nil)
+}
+
+// AnalyzeWithTones 实现 ToneHintAnalyzer 接口，每句台词附带可选的语气，用于重新询问
+func (api *OpenAIAPI) AnalyzeWithTones(ctx context.Context, dialogues []model.PreDialogue, tones [][]string) ([]model.PreDialogue, error) {
+	return api.analyzeTones(ctx, nil, dialogues, tones)
+}
+
+// analyzeTones 分析对话的语气，tones 不为空时要求模型只从每句列出的语气中选择
+func (api *OpenAIAPI) analyzeTones(ctx context.Context, preceding, dialogues []model.PreDialogue, tones [][]string) ([]model.PreDialogue, error) {
+	if len(dialogues) == 0 {
+		return nil, fmt.Errorf("对话列表不能为空")
+	}
+
+	queryJSON, err := json.Marshal(newToneQueries(dialogues, tones))
+	if err != nil {
+		return nil, fmt.Errorf("序列化对话失败: %v", err)
+	}
+
+	messages := []ChatMessage{{Role: RoleSystem, Content: api.systemPrompt()}}
+	for _, content := range buildContextMessages(api.Personas, preceding, dialogues) {
+		messages = append(messages, ChatMessage{Role: RoleUser, Content: content})
+	}
+	if tones != nil {
+		messages = append(messages, ChatMessage{Role: RoleUser, Content: toneReaskMessage})
+	}
+	messages = append(messages, ChatMessage{Role: RoleUser, Content: string(queryJSON)})
+
+	content, err := api.Chat(ctx, messages)
+	if err != nil {
+		return nil, fmt.Errorf("发送情绪分析请求失败: %w", err)
+	}
+
+	stepTones, err := parseStepTones(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析语气分析结果失败: %v", err)
+	}
+
+	result := make([]model.PreDialogue, len(dialogues))
+	copy(result, dialogues)
+	updatedCount := applyQueryTones(result, stepTones)
+	fmt.Printf("情绪分析完成，更新了 %d/%d 条对话的语气\n", updatedCount, len(result))
+
+	return result, nil
+}
+
+// Chat 发送 chat/completions 请求并返回第一条回复的内容
+func (api *OpenAIAPI) Chat(ctx context.Context, messages []ChatMessage) (string, error) {
+	req := ChatRequest{
+		Model:       api.Model,
+		Messages:    messages,
+		Temperature: api.Temperature,
+	}
+	if api.JSONMode {
+		req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	}
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	resp, err := api.Retry.Do(ctx, api.client, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", api.BaseURL+OpenAIChatPath, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set(HeaderContentType, ContentTypeJSON)
+		if api.APIKey != "" {
+			httpReq.Header.Set(HeaderAuth, "Bearer "+api.APIKey)
+		}
+		return httpReq, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("读取响应失败: %v", err)
+	}
+
+	var chatResp ChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return "", fmt.Errorf("解析响应失败: %v", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("响应中没有回复内容")
+	}
+
+	return chatResp.Choices[0].Message.Content, nil
+}
+
+// parseStepTones 解析模型输出，支持 {"tones": [...]}、[...] 以及包裹在代码块中的JSON
+func parseStepTones(content string) ([]StepTone, error) {
+	content = stripCodeFence(content)
+
+	var wrapped struct {
+		Tones []StepTone `json:"tones"`
+	}
+	if err := json.Unmarshal([]byte(content), &wrapped); err == nil && wrapped.Tones != nil {
+		return wrapped.Tones, nil
+	}
+
+	var tones []StepTone
+	if err := json.Unmarshal([]byte(content), &tones); err != nil {
+		return nil, err
+	}
+	return tones, nil
+}
+
+// stripCodeFence 去除 ```json ... ``` 代码块标记
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```")
+	if i := strings.Index(content, "\n"); i >= 0 {
+		content = content[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content), "```"))
+}
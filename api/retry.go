@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 重试策略默认值
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = time.Second
+	DefaultMaxDelay    = 30 * time.Second
+	DefaultJitter      = 0.2
+)
+
+// 可供调用方用 errors.Is 判断的错误类型
+var (
+	ErrTokenInvalid      = errors.New("token 无效或已过期，请检查配置中的 token")
+	ErrRateLimited       = errors.New("请求过于频繁，已被限流")
+	ErrServerUnavailable = errors.New("服务暂时不可用")
+	ErrRequestRejected   = errors.New("请求被拒绝")
+)
+
+// HTTPError 表示接口返回了非 200 状态码
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // 服务端通过 Retry-After 要求的等待时间，未指定时为0
+}
+
+// Error 实现 error 接口
+func (e *HTTPError) Error() string {
+	if e.Unwrap() == ErrTokenInvalid {
+		return fmt.Sprintf("%v (状态码 %d), 响应: %s", ErrTokenInvalid, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("API 返回错误状态码: %d, 响应: %s", e.StatusCode, e.Body)
+}
+
+// Unwrap 将状态码归类为 ErrTokenInvalid、ErrRateLimited 等错误
+func (e *HTTPError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrTokenInvalid
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServerUnavailable
+	default:
+		return ErrRequestRejected
+	}
+}
+
+// Retryable 判断该状态码是否值得重试
+func (e *HTTPError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RetryPolicy HTTP 请求的重试策略，采用带抖动的指数退避
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数，包括第一次请求
+	BaseDelay   time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 单次等待的上限，也是 Retry-After 的上限
+	Jitter      float64       // 等待时间的随机浮动比例，0.2 表示 ±20%
+}
+
+// DefaultRetryPolicy 返回默认的重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+		Jitter:      DefaultJitter,
+	}
+}
+
+// backoff 返回第 attempt 次失败后的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// Do 发送请求，传输错误和 429/502/503/504 按策略重试，其它非 200 状态码直接返回 *HTTPError
+// newRequest 每次尝试都会被调用以重新创建请求体；成功时由调用方关闭响应体
+func (p RetryPolicy) Do(ctx context.Context, client *http.Client, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("创建请求失败: %v", err)
+		}
+
+		resp, err := client.Do(req)
+		var delay time.Duration
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			err = fmt.Errorf("发送请求失败: %w", err)
+			delay = p.backoff(attempt)
+		} else if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		} else {
+			httpErr := newHTTPError(resp)
+			if !httpErr.Retryable() {
+				return nil, httpErr
+			}
+			err = httpErr
+			delay = p.backoff(attempt)
+			if httpErr.RetryAfter > 0 {
+				delay = httpErr.RetryAfter
+				if p.MaxDelay > 0 && delay > p.MaxDelay {
+					delay = p.MaxDelay
+				}
+			}
+		}
+
+		if attempt >= maxAttempts {
+			return nil, err
+		}
+		fmt.Printf("请求失败 (尝试 %d/%d): %v，%.1f 秒后重试...\n", attempt, maxAttempts, err, delay.Seconds())
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// newHTTPError 读取并关闭响应体，生成 HTTPError
+func newHTTPError(resp *http.Response) *HTTPError {
+	defer resp.Body.Close()
+	// 限制响应体大小
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter 解析 Retry-After 头，支持秒数和 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 5 * time.Second},  // 不超过上限
+		{attempt: 80, want: 5 * time.Second}, // 移位溢出时取上限
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			if got := policy.backoff(tt.attempt); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+
+	// 抖动不超过设定的比例
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(2); got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("带抖动的 backoff(2) = %v, 超出 ±20%%", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "未指定", value: ""},
+		{name: "秒数", value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{name: "零秒", value: "0"},
+		{name: "负数", value: "-1"},
+		{name: "无效值", value: "soon"},
+		{name: "HTTP日期", value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{name: "过去的HTTP日期", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %v, want [%v, %v]", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // 依次返回的状态码，用完后返回最后一个
+		retryAfter string
+		attempts   int // 预期的请求次数
+		wantErr    error
+		minElapsed time.Duration
+	}{
+		{name: "成功不重试", statuses: []int{200}, attempts: 1},
+		{name: "503后重试成功", statuses: []int{503, 200}, attempts: 2},
+		{name: "429重试直到次数用尽", statuses: []int{429}, attempts: 3, wantErr: ErrRateLimited},
+		{name: "401不重试", statuses: []int{401}, attempts: 1, wantErr: ErrTokenInvalid},
+		{name: "400不重试", statuses: []int{400}, attempts: 1, wantErr: ErrRequestRejected},
+		{name: "500不重试", statuses: []int{500}, attempts: 1, wantErr: ErrServerUnavailable},
+		// Retry-After 不超过 MaxDelay
+		{name: "按Retry-After等待", statuses: []int{429, 200}, retryAfter: "1", attempts: 2, minElapsed: 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&count, 1))
+				status := tt.statuses[len(tt.statuses)-1]
+				if n <= len(tt.statuses) {
+					status = tt.statuses[n-1]
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+			start := time.Now()
+			resp, err := policy.Do(context.Background(), server.Client(), func(ctx context.Context) (*http.Request, error) {
+				return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			})
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := int(atomic.LoadInt32(&count)); got != tt.attempts {
+				t.Errorf("请求次数 = %d, want %d", got, tt.attempts)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed || elapsed > time.Second {
+				t.Errorf("耗时 %v, want 不少于 %v 且受 MaxDelay 限制", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Minute}
+	_, err := policy.Do(ctx, server.Client(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"os"
+	"strings"
+)
+
+// ToneRule 关键词到语气的映射，Tone 为参考音频的语气目录名
+type ToneRule struct {
+	Keywords []string `json:"keywords"`
+	Tone     string   `json:"tone"`
+}
+
+// RuleToneConfig 规则语气分析器的配置
+type RuleToneConfig struct {
+	Rules       []ToneRule `json:"rules"`        // 按表情、动作名称匹配，如 anon/angry02 中的 angry
+	Punctuation []ToneRule `json:"punctuation"`  // 表情和动作都未匹配时按文本标点匹配
+	DefaultTone string     `json:"default_tone"` // 都未匹配时使用的语气，为空则不填充
+}
+
+// DefaultRuleToneConfig 返回内置的规则配置
+func DefaultRuleToneConfig() RuleToneConfig {
+	return RuleToneConfig{
+		Rules: []ToneRule{
+			{Keywords: []string{"angry", "anger", "rage"}, Tone: "angry"},
+			{Keywords: []string{"surprised", "surprise", "shock"}, Tone: "surprised"},
+			{Keywords: []string{"sad", "cry", "tear"}, Tone: "sad"},
+			{Keywords: []string{"smile", "happy", "laugh", "joy"}, Tone: "happy"},
+			{Keywords: []string{"shame", "shy", "blush"}, Tone: "shy"},
+			{Keywords: []string{"fear", "scared", "odoodo"}, Tone: "fear"},
+			{Keywords: []string{"serious"}, Tone: "serious"},
+			{Keywords: []string{"thinking", "think"}, Tone: "thinking"},
+		},
+		Punctuation: []ToneRule{
+			{Keywords: []string{"！！", "!!"}, Tone: "angry"},
+			{Keywords: []string{"……", "..."}, Tone: "sad"},
+			{Keywords: []string{"？", "?"}, Tone: "thinking"},
+			{Keywords: []string{"！", "!"}, Tone: "surprised"},
+		},
+		DefaultTone: "normal",
+	}
+}
+
+// LoadRuleToneConfig 从文件加载规则配置
+func LoadRuleToneConfig(configPath string) (RuleToneConfig, error) {
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return RuleToneConfig{}, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var config RuleToneConfig
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return RuleToneConfig{}, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return config, nil
+}
+
+// RuleToneAnalyzer 根据表情、动作名称和标点离线推断语气
+type RuleToneAnalyzer struct {
+	config RuleToneConfig
+}
+
+// NewRuleToneAnalyzer 创建规则语气分析器
+func NewRuleToneAnalyzer(config RuleToneConfig) *RuleToneAnalyzer {
+	return &RuleToneAnalyzer{config: config}
+}
+
+// Analyze 实现 ToneAnalyzer 接口，只填充尚未有语气的对话
+func (a *RuleToneAnalyzer) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]model.PreDialogue, len(dialogues))
+	copy(result, dialogues)
+	for i := range result {
+		if result[i].Tone == "" {
+			result[i].Tone = a.ToneFor(result[i])
+		}
+	}
+	return result, nil
+}
+
+// ToneFor 推断单条对话的语气，依次按表情、动作、标点匹配
+func (a *RuleToneAnalyzer) ToneFor(dialogue model.PreDialogue) string {
+	for _, name := range []string{dialogue.Expression, dialogue.Motion} {
+		if tone := matchToneRules(a.config.Rules, emotionName(name)); tone != "" {
+			return tone
+		}
+	}
+	if tone := matchToneRules(a.config.Punctuation, dialogue.Text); tone != "" {
+		return tone
+	}
+	return a.config.DefaultTone
+}
+
+// matchToneRules 返回第一条关键词出现在文本中的规则的语气
+func matchToneRules(rules []ToneRule, text string) string {
+	if text == "" {
+		return ""
+	}
+	for _, rule := range rules {
+		for _, keyword := range rule.Keywords {
+			if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+				return rule.Tone
+			}
+		}
+	}
+	return ""
+}
+
+// emotionName 取表情/动作ID中角色前缀之后的部分，如 anon/angry02 → angry02
+func emotionName(id string) string {
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+	return strings.ToLower(id)
+}
+
+// FallbackToneAnalyzer 主分析器失败时改用备用分析器，并由备用分析器补全主分析器遗漏的语气
+type FallbackToneAnalyzer struct {
+	Primary  ToneAnalyzer
+	Fallback ToneAnalyzer
+}
+
+// Analyze 实现 ToneAnalyzer 接口
+func (a *FallbackToneAnalyzer) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	result, err := a.Primary.Analyze(ctx, dialogues)
+	if err != nil {
+		// 用户取消时不再回退
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		fmt.Printf("语气分析失败，改用备用分析器: %v\n", err)
+		return a.Fallback.Analyze(ctx, dialogues)
+	}
+	return a.Fallback.Analyze(ctx, result)
+}
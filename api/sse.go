@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// SSEEvent 表示一个 Server-Sent Events 事件
+type SSEEvent struct {
+	Event string // 事件类型，未指定时为空
+	Data  string // 多行 data 以换行符连接
+	ID    string // 事件ID
+}
+
+// SSEReader 增量读取 Server-Sent Events 流
+type SSEReader struct {
+	reader *bufio.Reader
+}
+
+// NewSSEReader 创建新的 SSE 读取器
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{reader: bufio.NewReader(r)}
+}
+
+// Next 读取下一个事件，流结束时返回 io.EOF
+func (r *SSEReader) Next() (*SSEEvent, error) {
+	var event SSEEvent
+	var data []string
+	hasField := false
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			// 流结束时分派尚未以空行结束的事件
+			if err == io.EOF && hasField {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// 空行表示一个事件结束
+		if line == "" {
+			if !hasField {
+				continue
+			}
+			event.Data = strings.Join(data, "\n")
+			return &event, nil
+		}
+
+		// 以冒号开头的行是注释
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		default:
+			// retry 等其它字段不影响事件内容
+			continue
+		}
+		hasField = true
+	}
+}
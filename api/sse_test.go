@@ -0,0 +1,90 @@
+package api
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []SSEEvent
+	}{
+		{
+			name:   "单个事件",
+			stream: "event: conversation.message.delta\ndata: {\"content\":\"你\"}\n\n",
+			want:   []SSEEvent{{Event: "conversation.message.delta", Data: `{"content":"你"}`}},
+		},
+		{
+			name:   "多行data以换行连接",
+			stream: "event: done\ndata: 第一行\ndata: 第二行\ndata:\n\n",
+			want:   []SSEEvent{{Event: "done", Data: "第一行\n第二行\n"}},
+		},
+		{
+			name:   "多个事件和id",
+			stream: "id: 1\nevent: a\ndata: x\n\nid: 2\nevent: b\ndata: y\n\n",
+			want: []SSEEvent{
+				{Event: "a", Data: "x", ID: "1"},
+				{Event: "b", Data: "y", ID: "2"},
+			},
+		},
+		{
+			name:   "CRLF换行",
+			stream: "event: a\r\ndata: x\r\n\r\nevent: b\r\ndata: y\r\n\r\n",
+			want: []SSEEvent{
+				{Event: "a", Data: "x"},
+				{Event: "b", Data: "y"},
+			},
+		},
+		{
+			name:   "跳过注释、多余空行和未知字段",
+			stream: ": keep-alive\n\n\nretry: 1000\nevent: a\n: 注释\ndata: x\n\n",
+			want:   []SSEEvent{{Event: "a", Data: "x"}},
+		},
+		{
+			name:   "冒号后只去掉一个空格",
+			stream: "data:x\ndata:  y\n\n",
+			want:   []SSEEvent{{Data: "x\n y"}},
+		},
+		{
+			name:   "data中的冒号",
+			stream: "data: {\"a\":\"b:c\"}\n\n",
+			want:   []SSEEvent{{Data: `{"a":"b:c"}`}},
+		},
+		{
+			name:   "流结束时分派未以空行结束的事件",
+			stream: "event: a\ndata: x\n\nevent: done\ndata: [DONE]",
+			want: []SSEEvent{
+				{Event: "a", Data: "x"},
+				{Event: "done", Data: "[DONE]"},
+			},
+		},
+		{
+			name:   "空流",
+			stream: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewSSEReader(strings.NewReader(tt.stream))
+			var got []SSEEvent
+			for {
+				event, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				got = append(got, *event)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+)
+
+// 语气分析后端
+const (
+	AnalyzerBackendCoze   = "coze"
+	AnalyzerBackendRule   = "rule"
+	AnalyzerBackendOpenAI = "openai"
+)
+
+// DefaultToneAnalyzerConfig 语气分析器配置文件的默认路径
+var DefaultToneAnalyzerConfig = filepath.Join("config", "tone_analyzer.json")
+
+// ToneAnalyzer 语气分析器，为对话填充 Tone 字段
+type ToneAnalyzer interface {
+	Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error)
+}
+
+// ToneAnalyzerFunc 将普通函数适配为 ToneAnalyzer，便于接入简单实现或测试替身
+type ToneAnalyzerFunc func(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error)
+
+// Analyze 实现 ToneAnalyzer 接口
+func (f ToneAnalyzerFunc) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	return f(ctx, dialogues)
+}
+
+// 确保各后端实现了 ToneAnalyzer
+var (
+	_ ContextualToneAnalyzer = (*CozeAPI)(nil)
+	_ ContextualToneAnalyzer = (*OpenAIAPI)(nil)
+	_ ToneHintAnalyzer       = (*CozeAPI)(nil)
+	_ ToneHintAnalyzer       = (*OpenAIAPI)(nil)
+	_ ToneAnalyzer           = (*ChunkedToneAnalyzer)(nil)
+	_ ToneAnalyzer           = (*ValidatingToneAnalyzer)(nil)
+	_ ToneAnalyzer           = (*CachedToneAnalyzer)(nil)
+)
+
+// ToneAnalyzerConfig 表示语气分析器的配置结构
+type ToneAnalyzerConfig struct {
+	Backend       string      `json:"backend"`        // 使用的后端，默认为 coze
+	Fallback      string      `json:"fallback"`       // 主后端失败时使用的备用后端，为空则不回退
+	CozeConfig    string      `json:"coze_config"`    // Coze 配置文件路径
+	RuleConfig    string      `json:"rule_config"`    // 规则分析器配置文件路径，为空时使用内置规则
+	OpenAIConfig  string      `json:"openai_config"`  // OpenAI 兼容接口配置文件路径
+	Chunk         ChunkConfig `json:"chunk"`          // 远程后端的长脚本分段配置
+	PersonaConfig string      `json:"persona_config"` // 角色人设配置文件路径，为空时不发送人设
+
+	// 以下为语气校验配置，按流水线使用的参考音频校验，没有参考音频时不校验
+	ReferenceDir  string `json:"reference_dir"`  // 单独指定的参考音频根目录，为空时使用流水线的参考音频
+	SynonymConfig string `json:"synonym_config"` // 语气同义词配置文件路径，为空时使用内置同义词
+	DefaultTone   string `json:"default_tone"`   // 语气无法映射时使用的语气
+	MaxReask      *int   `json:"max_reask"`      // 语气无效时重新询问的次数
+
+	CacheFile    string `json:"cache_file"`    // 语气缓存文件路径，为空时不使用缓存
+	CacheContext *int   `json:"cache_context"` // 缓存键包含的前后文对话条数
+
+	Progress StreamProgressFunc `json:"-"` // Coze 流式响应的进度回调，由调用方设置，可为空
+}
+
+// LoadToneAnalyzerConfig 从文件读取语气分析器配置
+func LoadToneAnalyzerConfig(configPath string) (ToneAnalyzerConfig, error) {
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return ToneAnalyzerConfig{}, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var config ToneAnalyzerConfig
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return ToneAnalyzerConfig{}, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return config, nil
+}
+
+// NewToneAnalyzerFromConfig 根据配置文件创建语气分析器，refs 为流水线使用的参考音频列表
+func NewToneAnalyzerFromConfig(configPath string, refs []utils.AudioRefModel) (ToneAnalyzer, error) {
+	config, err := LoadToneAnalyzerConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewToneAnalyzer(config, refs)
+}
+
+// NewToneAnalyzer 根据配置创建语气分析器，分析结果按 refs 中实际存在的语气校验
+// 配置了 reference_dir 时改用该目录；两者都没有时不校验
+// 缓存只包住主后端，备用分析器补全的语气和校验时使用的默认语气都不会写入缓存
+// 语气无效时带上角色可用的语气直接重新询问主后端，规则后端无法接收语气列表，不重新询问
+func NewToneAnalyzer(config ToneAnalyzerConfig, refs []utils.AudioRefModel) (ToneAnalyzer, error) {
+	if config.ReferenceDir != "" {
+		var err error
+		refs, err = utils.BuildReferenceAudioList(config.ReferenceDir)
+		if err != nil {
+			return nil, fmt.Errorf("读取参考音频列表失败: %v", err)
+		}
+	}
+
+	analyzer, backendID, err := newToneAnalyzerBackend(config.Backend, config, refs)
+	if err != nil {
+		return nil, err
+	}
+	primary := analyzer
+
+	if config.CacheFile != "" {
+		cache, err := LoadToneCache(config.CacheFile)
+		if err != nil {
+			return nil, err
+		}
+		cached := NewCachedToneAnalyzer(analyzer, cache)
+		cached.Backend = backendID
+		if config.CacheContext != nil {
+			cached.ContextLines = *config.CacheContext
+		}
+		analyzer = cached
+	}
+
+	if config.Fallback != "" && config.Fallback != config.Backend {
+		fallback, _, err := newToneAnalyzerBackend(config.Fallback, config, refs)
+		if err != nil {
+			return nil, fmt.Errorf("创建备用语气分析器失败: %v", err)
+		}
+		analyzer = &FallbackToneAnalyzer{Primary: analyzer, Fallback: fallback}
+	}
+
+	if len(refs) > 0 {
+		validating, err := newValidatingToneAnalyzer(analyzer, config, refs)
+		if err != nil {
+			return nil, err
+		}
+		// 重新询问直接交给主后端，不经过缓存和备用分析器
+		validating.Reask = hintAnalyzerOf(primary)
+		analyzer = validating
+	}
+	return analyzer, nil
+}
+
+// hintAnalyzerOf 返回能够接收可选语气列表的后端，分段分析器取其内部分析器；不支持时返回空
+func hintAnalyzerOf(analyzer ToneAnalyzer) ToneHintAnalyzer {
+	if chunked, ok := analyzer.(*ChunkedToneAnalyzer); ok {
+		analyzer = chunked.Analyzer
+	}
+	hint, _ := analyzer.(ToneHintAnalyzer)
+	return hint
+}
+
+// loadPersonas 加载角色人设，路径为空时返回空；角色表可选，用于按别名查找人设
+func loadPersonas(path string) (*PersonaBook, error) {
+	if path == "" {
+		return nil, nil
+	}
+	registry, _ := utils.LoadCharacterRegistry(utils.DefaultModelPathConfig)
+	return LoadPersonaBook(path, registry)
+}
+
+// newValidatingToneAnalyzer 为分析器加上参考音频语气校验
+func newValidatingToneAnalyzer(analyzer ToneAnalyzer, config ToneAnalyzerConfig, refs []utils.AudioRefModel) (*ValidatingToneAnalyzer, error) {
+	synonyms := DefaultToneSynonymConfig()
+	if config.SynonymConfig != "" {
+		var err error
+		synonyms, err = LoadToneSynonymConfig(config.SynonymConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	validator := NewToneValidator(refs, synonyms)
+	validator.DefaultTone = config.DefaultTone
+
+	validating := NewValidatingToneAnalyzer(analyzer, validator)
+	if config.MaxReask != nil {
+		validating.MaxReask = *config.MaxReask
+	}
+	return validating, nil
+}
+
+// newToneAnalyzerBackend 创建指定后端的语气分析器，同时返回后端标识（后端名加 Bot 或模型），用于区分缓存
+// refs 中的语气会写入 OpenAI 后端的提示词，限定模型只能从实际存在的语气中选择
+func newToneAnalyzerBackend(backend string, config ToneAnalyzerConfig, refs []utils.AudioRefModel) (ToneAnalyzer, string, error) {
+	switch backend {
+	case "", AnalyzerBackendCoze:
+		cozeConfig := config.CozeConfig
+		if cozeConfig == "" {
+			cozeConfig = filepath.Join("config", "coze_config.json")
+		}
+		api, err := NewCozeAPIFromConfig(cozeConfig)
+		if err != nil {
+			return nil, "", err
+		}
+		if api.Personas, err = loadPersonas(config.PersonaConfig); err != nil {
+			return nil, "", err
+		}
+		api.Progress = config.Progress
+		return NewChunkedToneAnalyzer(api, config.Chunk), AnalyzerBackendCoze + ":" + api.BotID, nil
+	case AnalyzerBackendRule:
+		if config.RuleConfig == "" {
+			return NewRuleToneAnalyzer(DefaultRuleToneConfig()), AnalyzerBackendRule, nil
+		}
+		ruleConfig, err := LoadRuleToneConfig(config.RuleConfig)
+		if err != nil {
+			return nil, "", err
+		}
+		return NewRuleToneAnalyzer(ruleConfig), AnalyzerBackendRule + ":" + config.RuleConfig, nil
+	case AnalyzerBackendOpenAI:
+		openAIConfig := config.OpenAIConfig
+		if openAIConfig == "" {
+			openAIConfig = filepath.Join("config", "openai_config.json")
+		}
+		api, err := NewOpenAIAPIFromConfig(openAIConfig)
+		if err != nil {
+			return nil, "", err
+		}
+		api.SetAvailableTones(refs)
+		if api.Personas, err = loadPersonas(config.PersonaConfig); err != nil {
+			return nil, "", err
+		}
+		return NewChunkedToneAnalyzer(api, config.Chunk), AnalyzerBackendOpenAI + ":" + api.BaseURL + ":" + api.Model, nil
+	default:
+		return nil, "", fmt.Errorf("不支持的语气分析后端: %s", backend)
+	}
+}
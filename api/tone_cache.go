@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 语气缓存默认值
+const (
+	// DefaultToneCacheContext 计算缓存键时前后各纳入的对话条数
+	DefaultToneCacheContext = 1
+)
+
+// DefaultToneCacheFile 语气缓存文件的默认路径
+var DefaultToneCacheFile = filepath.Join("cache", "tone_cache.json")
+
+// ToneCacheEntry 一条缓存的语气分析结果
+type ToneCacheEntry struct {
+	Tone      string    `json:"tone"`
+	Speaker   string    `json:"speaker"` // 以下两项仅便于人工查看缓存文件
+	Text      string    `json:"text"`
+	File      string    `json:"file,omitempty"` // 对话所在脚本的绝对路径，用于按文件清除
+	Step      int       `json:"step"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ToneCacheStats 语气缓存的统计信息
+type ToneCacheStats struct {
+	Entries int // 缓存条目数
+	Hits    int // 本次运行命中的次数
+	Misses  int // 本次运行未命中的次数
+}
+
+// ToneCache 基于文件的语气分析结果缓存，键为后端标识、说话人、文本、表情、动作及前后文的哈希
+type ToneCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]ToneCacheEntry
+	hits    int
+	misses  int
+	dirty   bool
+}
+
+// LoadToneCache 从文件加载语气缓存，文件不存在时返回空缓存
+func LoadToneCache(path string) (*ToneCache, error) {
+	cache := &ToneCache{
+		path:    path,
+		entries: make(map[string]ToneCacheEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取语气缓存失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, fmt.Errorf("解析语气缓存失败: %v", err)
+	}
+	return cache, nil
+}
+
+// Get 查找缓存的语气
+func (c *ToneCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return entry.Tone, ok
+}
+
+// Put 写入语气，空语气不缓存
+func (c *ToneCache) Put(key string, dialogue model.PreDialogue) {
+	if dialogue.Tone == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && entry.Tone == dialogue.Tone {
+		return
+	}
+	entry := ToneCacheEntry{
+		Tone:      dialogue.Tone,
+		Speaker:   dialogue.Name,
+		Text:      dialogue.Text,
+		Step:      dialogue.Step,
+		UpdatedAt: time.Now(),
+	}
+	if dialogue.Source != nil {
+		entry.File = absPath(dialogue.Source.File)
+	}
+	c.entries[key] = entry
+	c.dirty = true
+}
+
+// Invalidate 清空缓存，并删除缓存文件
+func (c *ToneCache) Invalidate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]ToneCacheEntry)
+	c.dirty = false
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除语气缓存失败: %v", err)
+	}
+	return nil
+}
+
+// InvalidateFile 删除脚本 file 中对话的缓存并写回文件，steps 不为空时只删除这些 step，返回删除的条数
+func (c *ToneCache) InvalidateFile(file string, steps []int) (int, error) {
+	file = absPath(file)
+	selected := make(map[int]bool, len(steps))
+	for _, step := range steps {
+		selected[step] = true
+	}
+
+	c.mu.Lock()
+	removed := 0
+	for key, entry := range c.entries {
+		if entry.File != file || (len(steps) > 0 && !selected[entry.Step]) {
+			continue
+		}
+		delete(c.entries, key)
+		removed++
+	}
+	if removed > 0 {
+		c.dirty = true
+	}
+	c.mu.Unlock()
+
+	return removed, c.Save()
+}
+
+// absPath 返回绝对路径，失败时返回清理后的原路径
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Stats 返回缓存统计信息
+func (c *ToneCache) Stats() ToneCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ToneCacheStats{
+		Entries: len(c.entries),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// Save 将有改动的缓存写回文件
+func (c *ToneCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "    ")
+	if err != nil {
+		return fmt.Errorf("序列化语气缓存失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), utils.DirPermission); err != nil {
+		return fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	if err := os.WriteFile(c.path, data, utils.FilePermission); err != nil {
+		return fmt.Errorf("写入语气缓存失败: %v", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// ToneCacheKey 计算 dialogues[i] 的缓存键，后端标识以及前后各 contextLines 条对话的说话人和文本也计入哈希
+func ToneCacheKey(backend string, dialogues []model.PreDialogue, i, contextLines int) string {
+	h := sha256.New()
+	writeField := func(s string) {
+		fmt.Fprintf(h, "%d:%s;", len(s), s)
+	}
+
+	writeField(backend)
+	d := dialogues[i]
+	writeField(d.Id)
+	writeField(d.Name)
+	writeField(d.Text)
+	writeField(d.Expression)
+	writeField(d.Motion)
+
+	for j := i - contextLines; j <= i+contextLines; j++ {
+		if j == i {
+			continue
+		}
+		if j < 0 || j >= len(dialogues) {
+			writeField("")
+			continue
+		}
+		writeField(dialogues[j].Name + "\x00" + dialogues[j].Text)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CachedToneAnalyzer 复用未改动对话的语气，只把新增或改动的对话交给内部分析器
+// 内部分析器出错时不写入缓存，因此应只包住主后端，不要包住备用分析器
+// 缓存键取自传入列表中的前后文，因此只应传入完整的场景对话，重新询问等只含部分对话的请求不要经过缓存
+type CachedToneAnalyzer struct {
+	Analyzer     ToneAnalyzer
+	Cache        *ToneCache
+	Backend      string // 后端标识，计入缓存键，切换后端或模型后不复用之前的结果
+	ContextLines int    // 计算缓存键时前后各纳入的对话条数，同时作为发送给分析器的上下文
+}
+
+// NewCachedToneAnalyzer 创建带缓存的语气分析器
+func NewCachedToneAnalyzer(analyzer ToneAnalyzer, cache *ToneCache) *CachedToneAnalyzer {
+	return &CachedToneAnalyzer{
+		Analyzer:     analyzer,
+		Cache:        cache,
+		ContextLines: DefaultToneCacheContext,
+	}
+}
+
+// Analyze 实现 ToneAnalyzer 接口
+func (a *CachedToneAnalyzer) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	result := make([]model.PreDialogue, len(dialogues))
+	copy(result, dialogues)
+
+	keys := make([]string, len(result))
+	var misses []int
+	for i := range result {
+		keys[i] = ToneCacheKey(a.Backend, dialogues, i, a.ContextLines)
+		if tone, ok := a.Cache.Get(keys[i]); ok {
+			result[i].Tone = tone
+			continue
+		}
+		misses = append(misses, i)
+	}
+	fmt.Printf("语气缓存命中 %d/%d 条对话\n", len(result)-len(misses), len(result))
+
+	if len(misses) > 0 {
+		if err := a.analyzeMisses(ctx, result, misses); err != nil {
+			return nil, err
+		}
+		for _, i := range misses {
+			a.Cache.Put(keys[i], result[i])
+		}
+		if err := a.Cache.Save(); err != nil {
+			fmt.Printf("保存语气缓存失败: %v\n", err)
+		}
+	}
+
+	return result, nil
+}
+
+// analyzeMisses 分析未命中的对话，附带前后文对话作为上下文，结果只写回未命中的对话
+func (a *CachedToneAnalyzer) analyzeMisses(ctx context.Context, dialogues []model.PreDialogue, misses []int) error {
+	// 按原顺序收集未命中的对话及其上下文
+	include := make([]bool, len(dialogues))
+	for _, i := range misses {
+		for j := i - a.ContextLines; j <= i+a.ContextLines; j++ {
+			if j >= 0 && j < len(dialogues) {
+				include[j] = true
+			}
+		}
+	}
+	var indices []int
+	var subset []model.PreDialogue
+	for i, ok := range include {
+		if ok {
+			indices = append(indices, i)
+			subset = append(subset, dialogues[i])
+		}
+	}
+
+	analyzed, err := a.Analyzer.Analyze(ctx, subset)
+	if err != nil {
+		return err
+	}
+
+	miss := make(map[int]bool, len(misses))
+	for _, i := range misses {
+		miss[i] = true
+	}
+	// 分析器保持输入顺序时按位置合并，否则按来源文件和 Step 合并
+	if len(analyzed) == len(subset) {
+		for j, i := range indices {
+			if miss[i] && keyOf(analyzed[j]) == keyOf(dialogues[i]) {
+				dialogues[i].Tone = analyzed[j].Tone
+			}
+		}
+		return nil
+	}
+	tones := make(map[dialogueKey]string, len(analyzed))
+	for _, d := range analyzed {
+		tones[keyOf(d)] = d.Tone
+	}
+	for _, i := range misses {
+		if tone, ok := tones[keyOf(dialogues[i])]; ok {
+			dialogues[i].Tone = tone
+		}
+	}
+	return nil
+}
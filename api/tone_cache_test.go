@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"myvoicego/model"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestToneCacheKey(t *testing.T) {
+	base := []model.PreDialogue{
+		{Name: "soyo", Text: "a"},
+		{Name: "anon", Text: "b"},
+		{Name: "soyo", Text: "c"},
+		{Name: "anon", Text: "d"},
+	}
+	key := ToneCacheKey("coze", base, 1, 1)
+
+	tests := []struct {
+		name    string
+		backend string
+		change  func(dialogues []model.PreDialogue)
+		same    bool
+	}{
+		{name: "内容相同", backend: "coze", change: func([]model.PreDialogue) {}, same: true},
+		{name: "行号和来源不计入", backend: "coze", change: func(d []model.PreDialogue) {
+			d[1].Step = 42
+			d[1].Source = &model.SourcePos{File: "chapter1.txt"}
+		}, same: true},
+		{name: "前后文之外的对话不计入", backend: "coze", change: func(d []model.PreDialogue) { d[3].Text = "x" }, same: true},
+		{name: "后端不同", backend: "openai", change: func([]model.PreDialogue) {}},
+		{name: "文本不同", backend: "coze", change: func(d []model.PreDialogue) { d[1].Text = "x" }},
+		{name: "表情不同", backend: "coze", change: func(d []model.PreDialogue) { d[1].Expression = "smile" }},
+		{name: "前一句不同", backend: "coze", change: func(d []model.PreDialogue) { d[0].Text = "x" }},
+		{name: "后一句说话人不同", backend: "coze", change: func(d []model.PreDialogue) { d[2].Name = "taki" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialogues := append([]model.PreDialogue(nil), base...)
+			tt.change(dialogues)
+			if got := ToneCacheKey(tt.backend, dialogues, 1, 1) == key; got != tt.same {
+				t.Errorf("缓存键相同 = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+func TestCachedToneAnalyzer(t *testing.T) {
+	var requests [][]string
+	backend := ToneAnalyzerFunc(func(ctx context.Context, input []model.PreDialogue) ([]model.PreDialogue, error) {
+		var texts []string
+		result := append([]model.PreDialogue(nil), input...)
+		for i := range result {
+			texts = append(texts, result[i].Text)
+			result[i].Tone = "tone-" + result[i].Text
+		}
+		requests = append(requests, texts)
+		return result, nil
+	})
+
+	cache, err := LoadToneCache(filepath.Join(t.TempDir(), "tone_cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer := NewCachedToneAnalyzer(backend, cache)
+	analyzer.Backend = "test"
+
+	dialogues := []model.PreDialogue{
+		testDialogue("start.txt", 0, "a"),
+		testDialogue("start.txt", 1, "b"),
+		testDialogue("start.txt", 2, "c"),
+		testDialogue("start.txt", 3, "d"),
+		testDialogue("start.txt", 4, "e"),
+	}
+	edited := append([]model.PreDialogue(nil), dialogues...)
+	edited[4].Text = "e2"
+
+	tests := []struct {
+		name      string
+		dialogues []model.PreDialogue
+		request   []string // 发送给后端的对话，为空表示全部命中
+		hits      int
+		misses    int
+	}{
+		{name: "首次全部未命中", dialogues: dialogues, request: []string{"a", "b", "c", "d", "e"}, misses: 5},
+		{name: "未改动时全部命中", dialogues: dialogues, hits: 5, misses: 5},
+		// 改动的对话及其后一句的前后文变化，连同上下文一起发送
+		{name: "改动后只分析受影响的对话", dialogues: edited, request: []string{"c", "d", "e2"}, hits: 8, misses: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			result, err := analyzer.Analyze(context.Background(), tt.dialogues)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want [][]string
+			if tt.request != nil {
+				want = [][]string{tt.request}
+			}
+			if !reflect.DeepEqual(requests, want) {
+				t.Errorf("请求 = %v, want %v", requests, want)
+			}
+			for _, d := range result {
+				if d.Tone != "tone-"+d.Text {
+					t.Errorf("step %d 语气 = %q", d.Step, d.Tone)
+				}
+			}
+			stats := cache.Stats()
+			if stats.Hits != tt.hits || stats.Misses != tt.misses {
+				t.Errorf("命中 %d 未命中 %d, want %d %d", stats.Hits, stats.Misses, tt.hits, tt.misses)
+			}
+		})
+	}
+}
+
+func TestToneCacheInvalidateFile(t *testing.T) {
+	dir := t.TempDir()
+	start := filepath.Join(dir, "start.txt")
+	chapter := filepath.Join(dir, "chapter1.txt")
+
+	tests := []struct {
+		name    string
+		file    string
+		steps   []int
+		removed int
+	}{
+		{name: "清除整个文件", file: start, removed: 2},
+		{name: "只清除指定step", file: start, steps: []int{1}, removed: 1},
+		{name: "不存在的step", file: chapter, steps: []int{5}, removed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tone_cache.json")
+			cache, err := LoadToneCache(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range []model.PreDialogue{
+				testDialogue(start, 0, "a"),
+				testDialogue(start, 1, "b"),
+				testDialogue(chapter, 1, "c"),
+			} {
+				d.Tone = "normal"
+				cache.Put(d.Text, d)
+			}
+
+			removed, err := cache.InvalidateFile(tt.file, tt.steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.removed {
+				t.Errorf("removed = %d, want %d", removed, tt.removed)
+			}
+
+			// 清除结果已写回文件
+			reloaded, err := LoadToneCache(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reloaded.Stats().Entries; got != 3-tt.removed {
+				t.Errorf("剩余 %d 条, want %d", got, 3-tt.removed)
+			}
+		})
+	}
+}
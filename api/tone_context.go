@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPersonaConfig 角色人设配置文件的默认路径，与 model_path.json 放在一起
+var DefaultPersonaConfig = filepath.Join("config", "personas.json")
+
+// ContextualToneAnalyzer 能够接收前文对话作为上下文的语气分析器
+// 前文只用于帮助判断语气，不会出现在返回结果中
+type ContextualToneAnalyzer interface {
+	ToneAnalyzer
+	AnalyzeWithContext(ctx context.Context, preceding, dialogues []model.PreDialogue) ([]model.PreDialogue, error)
+}
+
+// ToneHintAnalyzer 能够为每句台词限定可选语气的分析器，用于重新询问语气无效的对话
+// tones[i] 为 dialogues[i] 可选的语气，为空时不限定
+type ToneHintAnalyzer interface {
+	AnalyzeWithTones(ctx context.Context, dialogues []model.PreDialogue, tones [][]string) ([]model.PreDialogue, error)
+}
+
+// toneReaskMessage 重新询问时放在对话之前的说明
+const toneReaskMessage = "以下台词上次给出的语气不在该角色可用的语气中，请重新判断，每句台词的语气只能从该句 tones 列出的语气中选择一个。"
+
+// toneQuery 发送给模型的精简对话信息，各后端共用
+// 只包含判断语气需要的字段，不发送本地文件路径等信息，分段时也按它估算大小
+// step 为对话在本次请求中的序号而不是脚本行号：多个场景的行号可能重复，模型按序号返回结果才能对应回去
+type toneQuery struct {
+	Step       int      `json:"step"`
+	Name       string   `json:"name"`
+	Text       string   `json:"text"`
+	Expression string   `json:"expression,omitempty"`
+	Motion     string   `json:"motion,omitempty"`
+	Tones      []string `json:"tones,omitempty"` // 重新询问时该句可选的语气
+}
+
+// newToneQuery 提取单条对话发送给模型的信息，step 为对话在请求中的序号
+func newToneQuery(step int, d model.PreDialogue) toneQuery {
+	return toneQuery{
+		Step:       step,
+		Name:       d.Name,
+		Text:       d.Text,
+		Expression: d.Expression,
+		Motion:     d.Motion,
+	}
+}
+
+// newToneQueries 提取对话列表发送给模型的信息，tones 不为空时附带每句可选的语气
+func newToneQueries(dialogues []model.PreDialogue, tones [][]string) []toneQuery {
+	queries := make([]toneQuery, 0, len(dialogues))
+	for i, d := range dialogues {
+		query := newToneQuery(i, d)
+		if i < len(tones) {
+			query.Tones = tones[i]
+		}
+		queries = append(queries, query)
+	}
+	return queries
+}
+
+// applyQueryTones 按请求中的序号（toneQuery.Step）将模型返回的语气写回对话，返回更新的数量
+func applyQueryTones(dialogues []model.PreDialogue, tones []StepTone) int {
+	updated := make(map[int]bool, len(tones))
+	for _, t := range tones {
+		if t.Tone == "" || t.Step < 0 || t.Step >= len(dialogues) {
+			continue
+		}
+		dialogues[t.Step].Tone = t.Tone
+		updated[t.Step] = true
+	}
+	return len(updated)
+}
+
+// dialogueKey 对话的唯一标识，Step 只在各自的脚本内唯一，多个场景的对话需要加上来源文件区分
+type dialogueKey struct {
+	file string
+	step int
+}
+
+// keyOf 返回对话的唯一标识
+func keyOf(d model.PreDialogue) dialogueKey {
+	key := dialogueKey{step: d.Step}
+	if d.Source != nil {
+		key.file = d.Source.File
+	}
+	return key
+}
+
+// applyDialogueTones 按 (来源文件, Step) 将 analyzed 中的语气写回 dialogues，返回更新的数量
+// 用于合并内部分析器返回的对话，返回结果的顺序和条数可以与输入不同
+func applyDialogueTones(dialogues, analyzed []model.PreDialogue) int {
+	tones := make(map[dialogueKey]string, len(analyzed))
+	for _, d := range analyzed {
+		if d.Tone != "" {
+			tones[keyOf(d)] = d.Tone
+		}
+	}
+
+	updatedCount := 0
+	for i := range dialogues {
+		if tone, exists := tones[keyOf(dialogues[i])]; exists {
+			dialogues[i].Tone = tone
+			updatedCount++
+		}
+	}
+	return updatedCount
+}
+
+// PersonaBook 角色人设说明，键可以是角色ID、名称或别名
+type PersonaBook struct {
+	notes    map[string]string
+	registry *utils.CharacterRegistry
+}
+
+// NewPersonaBook 创建人设表，registry 可为空
+func NewPersonaBook(notes map[string]string, registry *utils.CharacterRegistry) *PersonaBook {
+	return &PersonaBook{notes: notes, registry: registry}
+}
+
+// LoadPersonaBook 从文件加载人设表，文件内容为 {"角色": "人设说明"}
+func LoadPersonaBook(path string, registry *utils.CharacterRegistry) (*PersonaBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取人设配置失败: %v", err)
+	}
+
+	var notes map[string]string
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("解析人设配置失败: %v", err)
+	}
+	return NewPersonaBook(notes, registry), nil
+}
+
+// Lookup 查找对话说话人的人设说明
+func (b *PersonaBook) Lookup(dialogue model.PreDialogue) string {
+	if b == nil {
+		return ""
+	}
+
+	keys := []string{dialogue.Id, dialogue.Name}
+	// 人设可能写在角色的其它名称下
+	for _, key := range []string{dialogue.Id, dialogue.Name} {
+		if c, ok := b.registry.Lookup(key); ok {
+			keys = append(keys, c.Name)
+			keys = append(keys, c.Aliases...)
+		}
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if note, ok := b.notes[key]; ok {
+			return note
+		}
+	}
+	return ""
+}
+
+// buildContextMessages 生成对话之前的上下文消息：登场角色的人设、场景和背景、前文
+// 没有可用信息的部分不生成消息
+func buildContextMessages(personas *PersonaBook, preceding, dialogues []model.PreDialogue) []string {
+	var messages []string
+
+	if text := personaSummary(personas, dialogues); text != "" {
+		messages = append(messages, text)
+	}
+	if text := sceneSummary(dialogues); text != "" {
+		messages = append(messages, text)
+	}
+	if text := precedingSummary(preceding); text != "" {
+		messages = append(messages, text)
+	}
+	return messages
+}
+
+// personaSummary 列出登场角色的人设
+func personaSummary(personas *PersonaBook, dialogues []model.PreDialogue) string {
+	var sb strings.Builder
+	seen := make(map[string]bool)
+	for _, d := range dialogues {
+		key := d.Id + "\x00" + d.Name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if note := personas.Lookup(d); note != "" {
+			fmt.Fprintf(&sb, "- %s: %s\n", speakerName(d), note)
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "登场角色的人设：\n" + strings.TrimRight(sb.String(), "\n")
+}
+
+// sceneSummary 按出现顺序列出对话所在的场景和背景
+func sceneSummary(dialogues []model.PreDialogue) string {
+	var sb strings.Builder
+	last := ""
+	for i, d := range dialogues {
+		if d.Scene == "" && d.Background == "" {
+			continue
+		}
+		current := d.Scene + "\x00" + d.Background
+		if current == last {
+			continue
+		}
+		last = current
+
+		fmt.Fprintf(&sb, "- 从 step %d 起", i)
+		if d.Scene != "" {
+			fmt.Fprintf(&sb, "，场景 %s", d.Scene)
+		}
+		if d.Background != "" {
+			fmt.Fprintf(&sb, "，背景 %s", d.Background)
+		}
+		sb.WriteString("\n")
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "场景信息：\n" + strings.TrimRight(sb.String(), "\n")
+}
+
+// precedingSummary 列出前文对话，只供参考，不需要分析语气
+func precedingSummary(preceding []model.PreDialogue) string {
+	if len(preceding) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("前文（仅供参考，不需要分析语气）：\n")
+	for _, d := range preceding {
+		fmt.Fprintf(&sb, "%s: %s\n", speakerName(d), d.Text)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// speakerName 返回用于显示的说话人名称
+func speakerName(d model.PreDialogue) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.Id
+}
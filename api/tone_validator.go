@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxReask 语气无效时重新询问分析器的默认次数
+const DefaultMaxReask = 1
+
+// ToneGroup 一类情绪及其同义词，同义词可以是中文、英文或日文
+type ToneGroup struct {
+	Emotion  string   `json:"emotion"`
+	Synonyms []string `json:"synonyms"`
+}
+
+// ToneSynonymConfig 语气同义词配置
+type ToneSynonymConfig struct {
+	Groups []ToneGroup `json:"groups"`
+	Wheel  []string    `json:"wheel"` // 按情绪轮顺序排列的情绪，相邻情绪视为相近
+}
+
+// DefaultToneSynonymConfig 返回内置的同义词配置，情绪轮采用 Plutchik 的八种基本情绪
+func DefaultToneSynonymConfig() ToneSynonymConfig {
+	return ToneSynonymConfig{
+		Groups: []ToneGroup{
+			{Emotion: "joy", Synonyms: []string{"joy", "happy", "happiness", "smile", "laugh", "ecstasy", "serenity", "开心", "高兴", "快乐", "喜悦", "愉快", "兴奋", "欣喜", "嬉しい", "楽しい"}},
+			{Emotion: "trust", Synonyms: []string{"trust", "gentle", "kind", "tender", "acceptance", "admiration", "信任", "温柔", "安心", "亲切", "钦佩", "優しい"}},
+			{Emotion: "fear", Synonyms: []string{"fear", "scared", "afraid", "nervous", "anxious", "terror", "apprehension", "恐惧", "害怕", "恐怖", "紧张", "不安", "怖い"}},
+			{Emotion: "surprise", Synonyms: []string{"surprise", "surprised", "shock", "amazement", "distraction", "惊讶", "吃惊", "震惊", "惊喜", "驚き"}},
+			{Emotion: "sadness", Synonyms: []string{"sad", "sadness", "cry", "grief", "pensiveness", "悲伤", "难过", "伤心", "哭泣", "失落", "忧郁", "悲しい"}},
+			{Emotion: "disgust", Synonyms: []string{"disgust", "loathing", "boredom", "bored", "厌恶", "嫌弃", "恶心", "讨厌", "无聊", "嫌悪"}},
+			{Emotion: "anger", Synonyms: []string{"anger", "angry", "rage", "annoyance", "annoyed", "mad", "愤怒", "生气", "恼怒", "暴躁", "烦躁", "怒り"}},
+			{Emotion: "anticipation", Synonyms: []string{"anticipation", "interest", "curious", "vigilance", "serious", "thinking", "期待", "好奇", "认真", "严肃", "思考"}},
+			{Emotion: "shy", Synonyms: []string{"shy", "shame", "embarrassed", "blush", "害羞", "羞涩", "腼腆", "恥ずかしい"}},
+			{Emotion: "neutral", Synonyms: []string{"neutral", "normal", "calm", "default", "平静", "普通", "正常", "默认", "日常", "平常"}},
+		},
+		Wheel: []string{"joy", "trust", "fear", "surprise", "sadness", "disgust", "anger", "anticipation"},
+	}
+}
+
+// LoadToneSynonymConfig 从文件加载同义词配置
+func LoadToneSynonymConfig(configPath string) (ToneSynonymConfig, error) {
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return ToneSynonymConfig{}, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var config ToneSynonymConfig
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return ToneSynonymConfig{}, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return config, nil
+}
+
+// ToneValidator 将分析得到的语气约束到角色参考音频中实际存在的语气
+type ToneValidator struct {
+	refs        []utils.AudioRefModel
+	synonyms    ToneSynonymConfig
+	DefaultTone string // 语气无法映射时使用的语气，角色没有该语气时清空
+}
+
+// NewToneValidator 创建语气校验器
+func NewToneValidator(refs []utils.AudioRefModel, synonyms ToneSynonymConfig) *ToneValidator {
+	return &ToneValidator{refs: refs, synonyms: synonyms}
+}
+
+// Resolve 返回对话语气在该角色参考音频中对应的语气
+// 依次尝试同名语气、同一情绪的同义语气、情绪轮上相邻情绪的语气
+// 角色没有参考音频时 known 为 false，此时无法校验
+func (v *ToneValidator) Resolve(dialogue model.PreDialogue) (tone string, ok, known bool) {
+	subDir, found := utils.FindAudioRefSubDir(v.refs, dialogue.Id, dialogue.Name, dialogue.AudioId)
+	if !found {
+		return "", false, false
+	}
+	tone, ok = v.nearestTone(dialogue.Tone, subDir.ToneNames())
+	return tone, ok, true
+}
+
+// AvailableTones 返回对话角色参考音频中的语气，角色没有参考音频时返回空
+func (v *ToneValidator) AvailableTones(dialogue model.PreDialogue) []string {
+	subDir, found := utils.FindAudioRefSubDir(v.refs, dialogue.Id, dialogue.Name, dialogue.AudioId)
+	if !found {
+		return nil
+	}
+	return subDir.ToneNames()
+}
+
+// nearestTone 在可用语气中查找与 tone 最接近的语气
+func (v *ToneValidator) nearestTone(tone string, available []string) (string, bool) {
+	tone = strings.TrimSpace(tone)
+	if tone == "" {
+		return "", false
+	}
+	for _, name := range available {
+		if strings.EqualFold(name, tone) {
+			return name, true
+		}
+	}
+
+	emotion := v.emotionOf(tone)
+	if emotion == "" {
+		return "", false
+	}
+	for _, candidate := range append([]string{emotion}, v.wheelNeighbors(emotion)...) {
+		for _, name := range available {
+			if v.emotionOf(name) == candidate {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// emotionOf 返回语气所属的情绪，先精确匹配同义词，再按包含关系匹配（如“非常生气”）
+func (v *ToneValidator) emotionOf(tone string) string {
+	tone = strings.ToLower(strings.TrimSpace(tone))
+	for _, group := range v.synonyms.Groups {
+		if strings.EqualFold(group.Emotion, tone) {
+			return group.Emotion
+		}
+		for _, synonym := range group.Synonyms {
+			if strings.EqualFold(synonym, tone) {
+				return group.Emotion
+			}
+		}
+	}
+	for _, group := range v.synonyms.Groups {
+		for _, synonym := range group.Synonyms {
+			// 过短的同义词容易误匹配，不参与包含匹配
+			if utf8.RuneCountInString(synonym) >= 2 && strings.Contains(tone, strings.ToLower(synonym)) {
+				return group.Emotion
+			}
+		}
+	}
+	return ""
+}
+
+// wheelNeighbors 返回情绪轮上与 emotion 相邻的两种情绪，不在情绪轮上时返回空
+func (v *ToneValidator) wheelNeighbors(emotion string) []string {
+	wheel := v.synonyms.Wheel
+	for i, name := range wheel {
+		if name != emotion || len(wheel) < 2 {
+			continue
+		}
+		prev := wheel[(i+len(wheel)-1)%len(wheel)]
+		next := wheel[(i+1)%len(wheel)]
+		if prev == next {
+			return []string{next}
+		}
+		return []string{next, prev}
+	}
+	return nil
+}
+
+// fallbackTone 返回角色可用的默认语气，没有时返回空
+func (v *ToneValidator) fallbackTone(dialogue model.PreDialogue) string {
+	if v.DefaultTone == "" {
+		return ""
+	}
+	dialogue.Tone = v.DefaultTone
+	tone, ok, _ := v.Resolve(dialogue)
+	if !ok {
+		return ""
+	}
+	return tone
+}
+
+// ToneValidationReport 语气校验的结果报告
+type ToneValidationReport struct {
+	Mapped      int   // 通过同义词或相近情绪映射的对话数
+	Reasked     int   // 重新询问后获得有效语气的对话数
+	Defaulted   int   // 使用默认语气的对话数
+	Unresolved  []int // 最终仍没有有效语气的对话step
+	Unvalidated []int // 角色没有参考音频、无法校验的对话step
+}
+
+// ValidatingToneAnalyzer 校验内部分析器返回的语气，无效语气映射到最接近的可用语气，
+// 无法映射时带上角色可用的语气重新询问，仍无效则使用默认语气
+type ValidatingToneAnalyzer struct {
+	Analyzer  ToneAnalyzer
+	Validator *ToneValidator
+	Reask     ToneHintAnalyzer // 重新询问使用的分析器，为空时不重新询问
+	MaxReask  int              // 重新询问的次数，0 表示不重新询问
+}
+
+// NewValidatingToneAnalyzer 创建带语气校验的分析器，analyzer 能够接收可选语气列表时也用于重新询问
+func NewValidatingToneAnalyzer(analyzer ToneAnalyzer, validator *ToneValidator) *ValidatingToneAnalyzer {
+	reask, _ := analyzer.(ToneHintAnalyzer)
+	return &ValidatingToneAnalyzer{
+		Analyzer:  analyzer,
+		Validator: validator,
+		Reask:     reask,
+		MaxReask:  DefaultMaxReask,
+	}
+}
+
+// Analyze 实现 ToneAnalyzer 接口
+func (a *ValidatingToneAnalyzer) Analyze(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, error) {
+	result, report, err := a.AnalyzeWithReport(ctx, dialogues)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("语气校验完成，映射 %d 条，重新询问后修正 %d 条，使用默认语气 %d 条\n",
+		report.Mapped, report.Reasked, report.Defaulted)
+	if len(report.Unresolved) > 0 {
+		fmt.Printf("以下 %d 条对话没有有效语气，step: %v\n", len(report.Unresolved), report.Unresolved)
+	}
+	return result, nil
+}
+
+// AnalyzeWithReport 分析并校验对话语气，返回校验报告
+func (a *ValidatingToneAnalyzer) AnalyzeWithReport(ctx context.Context, dialogues []model.PreDialogue) ([]model.PreDialogue, ToneValidationReport, error) {
+	var report ToneValidationReport
+
+	analyzed, err := a.Analyzer.Analyze(ctx, dialogues)
+	if err != nil {
+		return nil, report, err
+	}
+	result := make([]model.PreDialogue, len(analyzed))
+	copy(result, analyzed)
+
+	invalid := a.validate(result, &report.Mapped)
+
+	for attempt := 1; a.Reask != nil && attempt <= a.MaxReask && len(invalid) > 0; attempt++ {
+		fmt.Printf("%d 条对话的语气无效，重新询问 (第 %d/%d 次)\n", len(invalid), attempt, a.MaxReask)
+		reasked, remaining, err := a.reask(ctx, result, invalid)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, report, err
+			}
+			fmt.Printf("重新询问失败: %v\n", err)
+			break
+		}
+		report.Reasked += reasked
+		invalid = remaining
+	}
+
+	for i := range result {
+		_, ok, known := a.Validator.Resolve(result[i])
+		if !known {
+			report.Unvalidated = append(report.Unvalidated, result[i].Step)
+			continue
+		}
+		if ok {
+			continue
+		}
+		result[i].Tone = a.Validator.fallbackTone(result[i])
+		if result[i].Tone != "" {
+			report.Defaulted++
+		} else {
+			report.Unresolved = append(report.Unresolved, result[i].Step)
+		}
+	}
+
+	return result, report, nil
+}
+
+// validate 将可映射的语气替换为可用语气，返回仍无效的对话下标
+func (a *ValidatingToneAnalyzer) validate(dialogues []model.PreDialogue, mapped *int) []int {
+	var invalid []int
+	for i := range dialogues {
+		tone, ok, known := a.Validator.Resolve(dialogues[i])
+		if !known {
+			continue
+		}
+		if !ok {
+			invalid = append(invalid, i)
+			continue
+		}
+		if tone != dialogues[i].Tone {
+			dialogues[i].Tone = tone
+			*mapped++
+		}
+	}
+	return invalid
+}
+
+// reask 将语气无效的对话连同角色可用的语气重新交给分析器，返回修正的数量和仍无效的对话下标
+func (a *ValidatingToneAnalyzer) reask(ctx context.Context, dialogues []model.PreDialogue, invalid []int) (int, []int, error) {
+	subset := make([]model.PreDialogue, 0, len(invalid))
+	tones := make([][]string, 0, len(invalid))
+	for _, i := range invalid {
+		d := dialogues[i]
+		d.Tone = ""
+		subset = append(subset, d)
+		tones = append(tones, a.Validator.AvailableTones(d))
+	}
+
+	analyzed, err := a.Reask.AnalyzeWithTones(ctx, subset, tones)
+	if err != nil {
+		return 0, invalid, err
+	}
+	applyDialogueTones(subset, analyzed)
+
+	fixed := 0
+	var remaining []int
+	for j, i := range invalid {
+		tone, ok, _ := a.Validator.Resolve(subset[j])
+		if !ok {
+			remaining = append(remaining, i)
+			continue
+		}
+		dialogues[i].Tone = tone
+		fixed++
+	}
+	return fixed, remaining, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"reflect"
+	"testing"
+)
+
+// testToneRefs 创建只有一个子目录的参考音频列表
+func testToneRefs(model string, tones ...string) []utils.AudioRefModel {
+	subDir := utils.AudioRefSubDir{AudioId: "a"}
+	for _, tone := range tones {
+		subDir.Tones = append(subDir.Tones, utils.AudioRefTone{Tone: tone})
+	}
+	return []utils.AudioRefModel{{Model: model, SubDirs: []utils.AudioRefSubDir{subDir}}}
+}
+
+func TestToneValidatorResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		available []string
+		tone      string
+		want      string
+		ok        bool
+	}{
+		{name: "同名语气忽略大小写", available: []string{"Happy", "sad"}, tone: "happy", want: "Happy", ok: true},
+		{name: "中文同义词", available: []string{"开心", "sad"}, tone: "happy", want: "开心", ok: true},
+		{name: "日文同义词", available: []string{"angry"}, tone: "怒り", want: "angry", ok: true},
+		{name: "包含同义词", available: []string{"sad"}, tone: "非常难过", want: "sad", ok: true},
+		{name: "情绪轮上的相邻情绪", available: []string{"gentle"}, tone: "joy", want: "gentle", ok: true},
+		{name: "情绪轮首尾相邻", available: []string{"curious"}, tone: "happy", want: "curious", ok: true},
+		{name: "同一情绪优先于相邻情绪", available: []string{"gentle", "smile"}, tone: "开心", want: "smile", ok: true},
+		{name: "不相邻的情绪不映射", available: []string{"sad"}, tone: "happy"},
+		{name: "不在情绪轮上的情绪不找相邻", available: []string{"happy"}, tone: "害羞"},
+		{name: "未知语气", available: []string{"normal"}, tone: "嘀咕"},
+		{name: "空语气", available: []string{"normal"}, tone: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewToneValidator(testToneRefs("soyo", tt.available...), DefaultToneSynonymConfig())
+			tone, ok, known := validator.Resolve(model.PreDialogue{Id: "soyo", Tone: tt.tone})
+			if !known {
+				t.Fatal("角色应有参考音频")
+			}
+			if tone != tt.want || ok != tt.ok {
+				t.Errorf("Resolve(%q) = %q, %v, want %q, %v", tt.tone, tone, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	validator := NewToneValidator(testToneRefs("soyo", "normal"), DefaultToneSynonymConfig())
+	if _, _, known := validator.Resolve(model.PreDialogue{Id: "anon", Tone: "normal"}); known {
+		t.Error("没有参考音频的角色 known 应为 false")
+	}
+}
+
+// hintAnalyzer 记录重新询问时收到的可选语气，并返回每句的第一个可选语气
+type hintAnalyzer struct {
+	tones [][]string
+}
+
+func (h *hintAnalyzer) AnalyzeWithTones(ctx context.Context, dialogues []model.PreDialogue, tones [][]string) ([]model.PreDialogue, error) {
+	h.tones = append(h.tones, tones...)
+	result := append([]model.PreDialogue(nil), dialogues...)
+	for i := range result {
+		if len(tones[i]) > 0 {
+			result[i].Tone = tones[i][0]
+		}
+	}
+	return result, nil
+}
+
+func TestValidatingToneAnalyzerReask(t *testing.T) {
+	refs := append(testToneRefs("soyo", "normal", "sad"), testToneRefs("anon", "angry")...)
+	dialogues := []model.PreDialogue{
+		{Id: "soyo", Step: 0, Text: "a"},
+		{Id: "anon", Step: 0, Text: "b", Source: &model.SourcePos{File: "chapter1.txt"}},
+		{Id: "soyo", Step: 1, Text: "c"},
+	}
+	// 主后端返回无法映射的语气
+	backend := ToneAnalyzerFunc(func(ctx context.Context, input []model.PreDialogue) ([]model.PreDialogue, error) {
+		result := append([]model.PreDialogue(nil), input...)
+		result[0].Tone = "嘀咕"
+		result[1].Tone = "嘀咕"
+		result[2].Tone = "难过"
+		return result, nil
+	})
+
+	t.Run("重新询问时附带每句可选的语气", func(t *testing.T) {
+		hint := &hintAnalyzer{}
+		analyzer := NewValidatingToneAnalyzer(backend, NewToneValidator(refs, DefaultToneSynonymConfig()))
+		analyzer.Reask = hint
+		result, report, err := analyzer.AnalyzeWithReport(context.Background(), dialogues)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := [][]string{{"normal", "sad"}, {"angry"}}; !reflect.DeepEqual(hint.tones, want) {
+			t.Errorf("可选语气 = %v, want %v", hint.tones, want)
+		}
+		var tones []string
+		for _, d := range result {
+			tones = append(tones, d.Tone)
+		}
+		if want := []string{"normal", "angry", "sad"}; !reflect.DeepEqual(tones, want) {
+			t.Errorf("tones = %v, want %v", tones, want)
+		}
+		if report.Mapped != 1 || report.Reasked != 2 {
+			t.Errorf("Mapped = %d Reasked = %d, want 1 2", report.Mapped, report.Reasked)
+		}
+	})
+
+	t.Run("后端不能接收可选语气时不重新询问", func(t *testing.T) {
+		validator := NewToneValidator(refs, DefaultToneSynonymConfig())
+		validator.DefaultTone = "normal"
+		analyzer := NewValidatingToneAnalyzer(backend, validator)
+		if analyzer.Reask != nil {
+			t.Fatal("普通分析器不应用于重新询问")
+		}
+		result, report, err := analyzer.AnalyzeWithReport(context.Background(), dialogues)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Reasked != 0 || report.Defaulted != 1 {
+			t.Errorf("Reasked = %d Defaulted = %d, want 0 1", report.Reasked, report.Defaulted)
+		}
+		if result[0].Tone != "normal" || result[1].Tone != "" {
+			t.Errorf("tones = %q %q, want normal 和空", result[0].Tone, result[1].Tone)
+		}
+		if !reflect.DeepEqual(report.Unresolved, []int{0}) {
+			t.Errorf("Unresolved = %v, want [0]", report.Unresolved)
+		}
+	})
+}
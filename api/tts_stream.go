@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+)
+
+// WAV 头部相关常量
+// GPT-SoVITS 流式输出时第一块是帧数为0的44字节标准头部，之后是不带头部的PCM数据，
+// 头部中的 RIFF 长度和 data 长度因此与实际音频不符
+const (
+	MediaTypeWAV = "wav"
+
+	wavHeaderSize     = 44
+	wavRIFFSizeOffset = 4
+	wavDataSizeOffset = 40
+	wavUnknownSize    = 0xFFFFFFFF // 长度未知，播放器会一直读到结尾
+)
+
+// partSuffix 写入中的音频文件后缀，完成后重命名为目标文件
+const partSuffix = ".part"
+
+// streamBody 将修正后的头部和剩余的响应体拼接为一个 ReadCloser
+type streamBody struct {
+	io.Reader
+	io.Closer
+}
+
+// GenerateTTSStream 以流式模式生成语音，音频边生成边返回，由调用方关闭
+// WAV 头部中为0的长度字段改为长度未知，便于播放器一直读到结尾；写入文件请使用 SaveTTS
+func (api *GPTSvotisAPI) GenerateTTSStream(ctx context.Context, req model.TTSRequest) (io.ReadCloser, error) {
+	req.StreamingMode = true
+	resp, err := api.postTTS(ctx, api.streamClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.MediaType != MediaTypeWAV {
+		return resp.Body, nil
+	}
+
+	header, err := readWAVHeader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if isStreamingWAVHeader(header) {
+		setWAVSizes(header, wavUnknownSize, wavUnknownSize)
+	}
+	return &streamBody{
+		Reader: io.MultiReader(bytes.NewReader(header), resp.Body),
+		Closer: resp.Body,
+	}, nil
+}
+
+// SaveTTS 生成语音并写入文件，返回写入的字节数，不受 MaxResponseSize 限制
+// req.StreamingMode 为 true 时边生成边写入，完成后按实际长度修正WAV头部
+// 音频先写入 .part 临时文件，成功后才替换目标文件，失败或取消时不留下不完整的音频
+func (api *GPTSvotisAPI) SaveTTS(ctx context.Context, req model.TTSRequest, path string) (int64, error) {
+	resp, err := api.postTTS(ctx, api.streamClient, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), utils.DirPermission); err != nil {
+		return 0, fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	partPath := path + partSuffix
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, utils.FilePermission)
+	if err != nil {
+		return 0, fmt.Errorf("创建音频文件失败: %w", err)
+	}
+
+	written, err := writeAudio(file, resp.Body, req.MediaType == MediaTypeWAV)
+	if closeErr := file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("写入音频失败: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return 0, err
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		os.Remove(partPath)
+		return 0, fmt.Errorf("保存音频失败: %w", err)
+	}
+	return written, nil
+}
+
+// writeAudio 将音频写入文件，wav 为 true 时按实际写入的长度修正头部
+func writeAudio(file *os.File, body io.Reader, wav bool) (int64, error) {
+	written, err := io.Copy(file, body)
+	if err != nil {
+		return written, fmt.Errorf("读取音频失败: %w", err)
+	}
+	if !wav || written < wavHeaderSize {
+		return written, nil
+	}
+
+	header := make([]byte, wavHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return written, fmt.Errorf("读取WAV头部失败: %w", err)
+	}
+	if !isCanonicalWAVHeader(header) {
+		return written, nil
+	}
+
+	riffSize, dataSize := uint32(written-8), uint32(written-wavHeaderSize)
+	if binary.LittleEndian.Uint32(header[wavDataSizeOffset:]) == dataSize {
+		return written, nil
+	}
+	setWAVSizes(header, riffSize, dataSize)
+	if _, err := file.WriteAt(header, 0); err != nil {
+		return written, fmt.Errorf("修正WAV头部失败: %w", err)
+	}
+	return written, nil
+}
+
+// readWAVHeader 读取WAV头部，音频不足44字节时返回已读到的部分
+func readWAVHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, wavHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("读取WAV头部失败: %w", err)
+	}
+	return header[:n], nil
+}
+
+// isCanonicalWAVHeader 判断是否为 fmt 块之后紧跟 data 块的44字节标准头部
+func isCanonicalWAVHeader(header []byte) bool {
+	return len(header) == wavHeaderSize &&
+		string(header[0:4]) == "RIFF" &&
+		string(header[8:12]) == "WAVE" &&
+		string(header[12:16]) == "fmt " &&
+		string(header[36:40]) == "data"
+}
+
+// isStreamingWAVHeader 判断是否为流式输出的头部，即 data 长度为0
+func isStreamingWAVHeader(header []byte) bool {
+	return isCanonicalWAVHeader(header) && binary.LittleEndian.Uint32(header[wavDataSizeOffset:]) == 0
+}
+
+// setWAVSizes 写入头部中的 RIFF 长度和 data 长度
+func setWAVSizes(header []byte, riffSize, dataSize uint32) {
+	binary.LittleEndian.PutUint32(header[wavRIFFSizeOffset:], riffSize)
+	binary.LittleEndian.PutUint32(header[wavDataSizeOffset:], dataSize)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testWAVHeader 创建44字节标准头部，data 长度为 dataSize
+func testWAVHeader(dataSize uint32) []byte {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	copy(header[8:], "WAVEfmt ")
+	copy(header[36:], "data")
+	setWAVSizes(header, dataSize+wavHeaderSize-8, dataSize)
+	return header
+}
+
+func TestWriteAudio(t *testing.T) {
+	pcm := bytes.Repeat([]byte{1, 2}, 100)
+	withPCM := func(header []byte) []byte {
+		return append(append([]byte(nil), header...), pcm...)
+	}
+	mp3 := append([]byte("ID3"), pcm...)
+	chunked := testWAVHeader(0)
+	copy(chunked[36:], "LIST") // fmt 之后不是 data 块，不修正
+
+	tests := []struct {
+		name     string
+		audio    []byte
+		wav      bool
+		riffSize uint32 // 预期的 RIFF 长度，0 表示不检查头部
+		dataSize uint32
+	}{
+		{name: "流式头部按实际长度修正", audio: withPCM(testWAVHeader(0)), wav: true, riffSize: 236, dataSize: 200},
+		{name: "长度未知的头部按实际长度修正", audio: withPCM(testWAVHeader(wavUnknownSize)), wav: true, riffSize: 236, dataSize: 200},
+		{name: "长度正确时不改动", audio: withPCM(testWAVHeader(200)), wav: true, riffSize: 236, dataSize: 200},
+		{name: "非标准头部不改动", audio: withPCM(chunked), wav: true},
+		{name: "不足一个头部", audio: []byte("RIFF"), wav: true},
+		{name: "非WAV格式原样写入", audio: mp3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			written, err := writeAudio(file, bytes.NewReader(tt.audio), tt.wav)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(len(tt.audio)) {
+				t.Errorf("written = %d, want %d", written, len(tt.audio))
+			}
+
+			got, err := io.ReadAll(io.NewSectionReader(file, 0, written))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.riffSize == 0 {
+				if !bytes.Equal(got, tt.audio) {
+					t.Error("音频被改动")
+				}
+				return
+			}
+			if riff := binary.LittleEndian.Uint32(got[wavRIFFSizeOffset:]); riff != tt.riffSize {
+				t.Errorf("RIFF 长度 = %d, want %d", riff, tt.riffSize)
+			}
+			if data := binary.LittleEndian.Uint32(got[wavDataSizeOffset:]); data != tt.dataSize {
+				t.Errorf("data 长度 = %d, want %d", data, tt.dataSize)
+			}
+			if !bytes.Equal(got[wavHeaderSize:], pcm) {
+				t.Error("PCM 数据被改动")
+			}
+		})
+	}
+}
+
+func TestIsStreamingWAVHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{name: "data长度为0", header: testWAVHeader(0), want: true},
+		{name: "data长度已知", header: testWAVHeader(200)},
+		{name: "头部不完整", header: testWAVHeader(0)[:40]},
+		{name: "不是RIFF", header: append([]byte("RIFX"), testWAVHeader(0)[4:]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStreamingWAVHeader(tt.header); got != tt.want {
+				t.Errorf("isStreamingWAVHeader = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
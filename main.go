@@ -1,13 +1,348 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"myvoicego/api"
+	"myvoicego/model"
+	"myvoicego/parser"
+	"myvoicego/pipeline"
 	"myvoicego/ui/views"
+	"myvoicego/utils"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 )
 
+// streamProgressStep 命令行模式下每接收多少字的语气分析结果输出一次进度
+const streamProgressStep = 200
+
 func main() {
+	checkScript := flag.String("check", "", "检查WebGAL脚本或游戏目录并列出诊断信息，不启动界面")
+	toneCacheStats := flag.Bool("tone-cache-stats", false, "显示语气缓存的条目数，不启动界面")
+	clearToneCache := flag.Bool("clear-tone-cache", false, "清空语气缓存，不启动界面")
+	toneCacheScript := flag.String("tone-cache-script", "", "配合 -clear-tone-cache 使用，只清除该脚本中对话的语气缓存")
+	toneCacheSteps := flag.String("tone-cache-steps", "", "配合 -tone-cache-script 使用，只清除这些 step 的语气缓存，以逗号分隔，如 3,5")
+	runScript := flag.String("run", "", "为WebGAL脚本或游戏目录（按场景跳转加载所有可达场景）生成语音，不启动界面，Ctrl+C 取消")
+	checkModels := flag.Bool("check-models", false, "检查 model_path.json 中的角色和模型权重文件，不启动界面")
+	refDir := flag.String("ref", "reference", "参考音频根目录，配合 -run 使用")
+	writeVocals := flag.Bool("write-vocals", false, "将 -vocal= 回写到脚本，原文件备份为 .bak；配合 -run 时在生成后回写，单独使用时回写输出目录中已生成的语音，用法: -write-vocals [-dry-run] 脚本或游戏目录")
+	outputDir := flag.String("out", "output", "语音输出目录，配合 -run、-write-vocals 使用")
+	dryRun := flag.Bool("dry-run", false, "只显示 -write-vocals 将做的修改，不写入脚本")
+	varsFile := flag.String("vars", parser.DefaultVariablesConfig, "文本变量 {var} 的朗读值配置，配合 -check、-run 使用")
+	flag.Parse()
+
+	// 命令行模式：检查脚本
+	if *checkScript != "" {
+		os.Exit(runCheck(*checkScript, *varsFile))
+	}
+
+	// 命令行模式：检查模型配置
+	if *checkModels {
+		os.Exit(runModelCheck())
+	}
+
+	// 命令行模式：生成语音
+	if *runScript != "" {
+		os.Exit(runPipeline(*runScript, *refDir, *outputDir, *varsFile, *writeVocals, *dryRun))
+	}
+
+	// 命令行模式：管理语气缓存
+	if *toneCacheStats || *clearToneCache {
+		os.Exit(runToneCache(*clearToneCache, *toneCacheScript, *toneCacheSteps))
+	}
+
+	// 命令行模式：回写 -vocal=
+	if *writeVocals {
+		os.Exit(runWriteVocals(flag.Arg(0), *outputDir, *dryRun))
+	}
+
 	// 创建主视图
 	mainView := views.NewMainView()
 
 	// 运行应用
 	mainView.Run()
 }
+
+// runCheck 解析脚本或WebGAL游戏目录并输出诊断信息，有诊断信息时返回非零退出码
+func runCheck(path, varsFile string) int {
+	// 角色表是可选的，读取失败时只按 -figureId 识别说话人
+	registry, _ := utils.LoadCharacterRegistry(utils.DefaultModelPathConfig)
+	variables, err := parser.LoadVariables(varsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if info.IsDir() {
+		return runProjectCheck(path, registry, variables)
+	}
+
+	p := parser.NewDialogueParser()
+	p.SetCharacterRegistry(registry)
+	p.SetVariables(variables)
+	if err := p.ParseFile(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diagnostics := p.Diagnostics()
+	fmt.Print(parser.FormatDiagnostics(diagnostics))
+	fmt.Printf("共解析 %d 条对话，%d 条诊断信息\n", len(p.Dialogues()), len(diagnostics))
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runProjectCheck 检查整个WebGAL工程，并列出不可达的场景
+func runProjectCheck(gameDir string, registry *utils.CharacterRegistry, variables map[string]string) int {
+	project, err := parser.LoadProject(gameDir, registry, variables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diagnostics := project.AllDiagnostics()
+	fmt.Print(parser.FormatDiagnostics(diagnostics))
+	for _, scene := range project.Unreachable {
+		fmt.Printf("不可达场景: %s\n", scene)
+	}
+	fmt.Printf("共解析 %d 个场景、%d 条对话，%d 条诊断信息\n",
+		len(project.Scenes), len(project.Dialogues()), len(diagnostics))
+	if len(diagnostics) > 0 || len(project.Unreachable) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runModelCheck 检查角色模型配置，权重文件按 gpt_svotis_path.json 中的 GSV_Path 查找
+func runModelCheck() int {
+	registry, err := utils.LoadCharacterRegistry(utils.DefaultModelPathConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// 没有 GSV_Path 时只检查配置本身
+	gsvPath := ""
+	if config, err := utils.LoadGSVConfig(utils.DefaultGSVConfig); err == nil {
+		gsvPath = config.Path
+	} else {
+		fmt.Fprintf(os.Stderr, "%v，跳过权重文件检查\n", err)
+	}
+
+	errs := registry.Validate(gsvPath)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	for _, c := range registry.Characters {
+		for _, m := range c.Models {
+			fmt.Printf("%s: %s (%s, %s)\n", c.Name, m.VariantName(), m.GPTWeights, m.SoVITSWeights)
+		}
+	}
+	fmt.Printf("共 %d 个角色，%d 个问题\n", len(registry.Characters), len(errs))
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runToneCache 显示或清空语气缓存，缓存路径取自语气分析器配置
+// 指定 file 时只清除该脚本的缓存，steps 进一步限定为其中的若干 step
+func runToneCache(clear bool, file, steps string) int {
+	cacheFile := api.DefaultToneCacheFile
+	if config, err := api.LoadToneAnalyzerConfig(api.DefaultToneAnalyzerConfig); err == nil && config.CacheFile != "" {
+		cacheFile = config.CacheFile
+	}
+
+	cache, err := api.LoadToneCache(cacheFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	stats := cache.Stats()
+	if !clear {
+		fmt.Printf("语气缓存 %s: %d 条\n", cacheFile, stats.Entries)
+		return 0
+	}
+
+	if file != "" {
+		selected, err := parseSteps(steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		removed, err := cache.InvalidateFile(file, selected)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Printf("已清除 %s 的语气缓存 %d 条，剩余 %d 条\n", file, removed, stats.Entries-removed)
+		return 0
+	}
+
+	if err := cache.Invalidate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Printf("已清空语气缓存 %s，共 %d 条\n", cacheFile, stats.Entries)
+	return 0
+}
+
+// parseSteps 解析以逗号分隔的 step 列表，为空时返回空
+func parseSteps(s string) ([]int, error) {
+	var steps []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		step, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 step: %s", field)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// runPipeline 为脚本或游戏目录生成语音，收到中断信号时取消正在进行的请求
+// writeVocals 为 true 时将已生成的语音回写为 -vocal=，dryRun 时只显示修改
+func runPipeline(scriptPath, refDir, outputDir, varsFile string, writeVocals, dryRun bool) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	refs, err := utils.BuildReferenceAudioList(refDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	analyzerConfig, err := api.LoadToneAnalyzerConfig(api.DefaultToneAnalyzerConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	tts, err := api.NewGPTSvotisAPIFromConfig(utils.DefaultGSVConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	p := pipeline.NewPipeline(nil, tts, refs, outputDir)
+	analyzerConfig.Progress = p.StreamProgress()
+	if p.Analyzer, err = api.NewToneAnalyzer(analyzerConfig, refs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	p.Registry, _ = utils.LoadCharacterRegistry(utils.DefaultModelPathConfig)
+	p.Models = pipeline.RegistryModelResolver(p.Registry)
+	if p.Variables, err = parser.LoadVariables(varsFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	received := 0
+	p.Progress = func(stage pipeline.Stage, done, total int) {
+		switch {
+		case stage == pipeline.StageReceive && done >= received+streamProgressStep:
+			// 流式响应按字符回调，每隔一段输出一次
+			received = done
+			fmt.Printf("已接收语气分析结果 %d 字\n", done)
+		case stage == pipeline.StageSynthesize && done < total:
+			fmt.Printf("正在生成语音 %d/%d\n", done+1, total)
+		}
+	}
+
+	result, err := p.Run(ctx, scriptPath)
+	fmt.Print(parser.FormatDiagnostics(result.Diagnostics))
+	fmt.Println(result.Summary())
+
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "已取消")
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+	if writeVocals {
+		if code := rewriteVocals(result.Dialogues, dryRun); code != 0 {
+			return code
+		}
+	}
+	if result.Failed() > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runWriteVocals 为脚本或游戏目录中输出音频已存在的对话回写 -vocal=，dryRun 时只输出差异
+func runWriteVocals(path, outputDir string, dryRun bool) int {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "请指定要回写的脚本或游戏目录，如 -write-vocals game")
+		return 2
+	}
+	// 角色表是可选的，读取失败时只按 -figureId 识别说话人
+	registry, _ := utils.LoadCharacterRegistry(utils.DefaultModelPathConfig)
+
+	dialogues, err := loadDialogues(path, registry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// 输出路径与生成时一致，只回写音频已存在的对话
+	posts := parser.NewPostDialogueBuilder(nil, outputDir).Build(dialogues)
+	parser.MarkExistingOutputs(posts)
+	return rewriteVocals(posts, dryRun)
+}
+
+// loadDialogues 解析脚本，或加载游戏目录中所有可达场景的对话
+func loadDialogues(path string, registry *utils.CharacterRegistry) ([]model.PreDialogue, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		project, err := parser.LoadProject(path, registry, nil)
+		if err != nil {
+			return nil, err
+		}
+		return project.Dialogues(), nil
+	}
+
+	p := parser.NewDialogueParser()
+	p.SetCharacterRegistry(registry)
+	if err := p.ParseFile(path); err != nil {
+		return nil, err
+	}
+	return p.Dialogues(), nil
+}
+
+// rewriteVocals 将生成完成的语音按脚本文件回写 -vocal=，dryRun 时只输出差异
+func rewriteVocals(posts []model.PostDialogue, dryRun bool) int {
+	all, err := parser.WriteVocalsFromPostDialogues(posts, parser.VocalRewriteOptions{
+		DryRun: dryRun,
+		Backup: true,
+	})
+	fmt.Print(parser.FormatScriptVocalDiff(all))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if dryRun {
+		fmt.Printf("预览：将修改 %d 个脚本中的 %d 行\n", len(all), parser.CountVocalChanges(all))
+	} else {
+		fmt.Printf("已回写 %d 个脚本中的 %d 行 -vocal=\n", len(all), parser.CountVocalChanges(all))
+	}
+	return 0
+}
@@ -2,13 +2,51 @@ package model
 
 // Dialogue 对话初解析模型
 type PreDialogue struct {
-	Name       string `json:"name"`
-	Id         string `json:"id"`
-	Text       string `json:"text"`
-	Step       int    `json:"step"`
-	Motion     string `json:"motion"`
-	Expression string `json:"expression"`
-	Model      string `json:"model"`
-	Tone       string `json:"tone"`
-	AudioId    string `json:"audioid"`
+	Name         string     `json:"name"`
+	Id           string     `json:"id"`
+	Text         string     `json:"text"`
+	SpokenText   string     `json:"spoken_text"`
+	Step         int        `json:"step"`
+	Motion       string     `json:"motion"`
+	Expression   string     `json:"expression"`
+	Model        string     `json:"model"`
+	Tone         string     `json:"tone"`
+	AudioId      string     `json:"audioid"`
+	ModelVariant string     `json:"model_variant,omitempty"` // 行内 -voiceModel 指定的模型
+	Scene        string     `json:"scene,omitempty"`         // 所在场景文件名
+	Background   string     `json:"background,omitempty"`    // 当前 changeBg 设置的背景
+	Source       *SourcePos `json:"source,omitempty"`
+}
+
+// PostDialogueStatus 对话语音的生成状态
+type PostDialogueStatus string
+
+const (
+	PostDialoguePending PostDialogueStatus = "pending" // 等待生成
+	PostDialogueSkipped PostDialogueStatus = "skipped" // 缺少参考音频等原因被跳过
+	PostDialogueDone    PostDialogueStatus = "done"    // 生成完成
+	PostDialogueFailed  PostDialogueStatus = "failed"  // 生成失败
+)
+
+// PostDialogue 对话后处理模型，在初解析结果上附加语音合成所需的信息
+type PostDialogue struct {
+	PreDialogue
+	ResolvedTone string             `json:"resolved_tone"`   // 实际使用的语气（参考音频目录名）
+	RefAudioPath string             `json:"ref_audio_path"`  // 选中的参考音频
+	PromptText   string             `json:"prompt_text"`     // 参考音频的提示文本
+	PromptLang   string             `json:"prompt_lang"`     // 提示文本的语言
+	TextLang     string             `json:"text_lang"`       // 对话文本的语言
+	TTS          TTSRequest         `json:"tts"`             // 发送给TTS API的参数
+	OutputPath   string             `json:"output_path"`     // 输出音频路径
+	Status       PostDialogueStatus `json:"status"`          // 生成状态
+	Error        string             `json:"error,omitempty"` // 失败或跳过的原因
+}
+
+// SourcePos 表示对话在脚本中的位置
+type SourcePos struct {
+	File   string `json:"file,omitempty"` // 脚本文件
+	Line   int    `json:"line"`           // 行号，从1开始
+	Column int    `json:"column"`         // 行内字节列号，从1开始
+	Offset int    `json:"offset"`         // 起始位置在文件中的字节偏移
+	End    int    `json:"end"`            // 结束位置在文件中的字节偏移（不含）
 }
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"strings"
+)
+
+// Severity 诊断级别
+type Severity string
+
+const (
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// DiagnosticCode 诊断类型
+type DiagnosticCode string
+
+const (
+	DiagUnknownFigure  DiagnosticCode = "unknown-figure"   // 引用的立绘ID不在场
+	DiagNoActiveFigure DiagnosticCode = "no-active-figure" // 对话找不到说话人对应的立绘或角色
+	DiagMalformedArg   DiagnosticCode = "malformed-arg"    // 参数缺少值或JSON格式错误
+	DiagDuplicateId    DiagnosticCode = "duplicate-id"     // 立绘ID被另一个角色的立绘占用
+)
+
+// Diagnostic 解析脚本时产生的诊断信息
+type Diagnostic struct {
+	Severity Severity        `json:"severity"`
+	Code     DiagnosticCode  `json:"code"`
+	Message  string          `json:"message"`
+	Pos      model.SourcePos `json:"pos"`
+}
+
+// String 格式化为 文件:行:列: 级别: 信息 [类型]
+func (d Diagnostic) String() string {
+	file := d.Pos.File
+	if file == "" {
+		file = "<script>"
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", file, d.Pos.Line, d.Pos.Column, d.Severity, d.Message, d.Code)
+}
+
+// FormatDiagnostics 将诊断列表格式化为多行文本
+func FormatDiagnostics(diagnostics []Diagnostic) string {
+	var sb strings.Builder
+	for _, d := range diagnostics {
+		sb.WriteString(d.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// requiredValueArgs 各命令中必须带值的参数
+var requiredValueArgs = map[string][]string{
+	CommandSay:          {"figureId", "vocal"},
+	CommandChangeFigure: {"id", "motion", "expression", "transform"},
+}
+
+// checkArgs 检查语句参数，报告缺少值和JSON格式错误的参数
+func (p *DialogueParser) checkArgs(stmt *Statement, step int) {
+	for _, arg := range stmt.Args {
+		if strings.HasPrefix(arg.Value, "{") && !json.Valid([]byte(arg.Value)) {
+			p.warn(DiagMalformedArg, p.position(step, arg.Start, arg.End),
+				"参数 -%s 的JSON值格式错误", arg.Key)
+		}
+	}
+
+	for _, key := range requiredValueArgs[stmt.Command] {
+		arg, ok := stmt.Arg(key)
+		if ok && arg.Value == "" {
+			p.warn(DiagMalformedArg, p.position(step, arg.Start, arg.End),
+				"参数 -%s 缺少值", arg.Key)
+		}
+	}
+}
+
+// warn 记录一条警告
+func (p *DialogueParser) warn(code DiagnosticCode, pos model.SourcePos, format string, args ...any) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityWarning,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Pos:      pos,
+	})
+}
+
+// position 根据行内字节偏移计算源码位置
+func (p *DialogueParser) position(step, start, end int) model.SourcePos {
+	return model.SourcePos{
+		File:   p.file,
+		Line:   step + 1,
+		Column: start + 1,
+		Offset: p.lineOffset + start,
+		End:    p.lineOffset + end,
+	}
+}
+
+// Diagnostics 返回解析过程中产生的诊断信息
+func (p *DialogueParser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
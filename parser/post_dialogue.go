@@ -1 +1,139 @@
 package parser
+
+import (
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"path/filepath"
+	"strings"
+)
+
+// PostDialogueBuilder 将情绪分析后的对话与参考音频匹配，生成语音合成任务
+type PostDialogueBuilder struct {
+	refs        []utils.AudioRefModel
+	outputDir   string
+	DefaultTone string // 对话语气在参考音频中不存在时优先使用的语气
+}
+
+// NewPostDialogueBuilder 创建新的后处理构建器
+func NewPostDialogueBuilder(refs []utils.AudioRefModel, outputDir string) *PostDialogueBuilder {
+	return &PostDialogueBuilder{
+		refs:      refs,
+		outputDir: outputDir,
+	}
+}
+
+// Build 将分析后的对话列表转换为后处理对话列表，重名的输出文件依次加上 _2、_3 等后缀
+func (b *PostDialogueBuilder) Build(dialogues []model.PreDialogue) []model.PostDialogue {
+	posts := make([]model.PostDialogue, 0, len(dialogues))
+	used := make(map[string]bool, len(dialogues))
+	for _, dialogue := range dialogues {
+		post := b.BuildOne(dialogue)
+		post.OutputPath = uniquePath(post.OutputPath, used)
+		posts = append(posts, post)
+	}
+	return posts
+}
+
+// uniquePath 返回未被使用的路径并记录，重名时在扩展名前加上序号
+func uniquePath(path string, used map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	unique := path
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+	used[unique] = true
+	return unique
+}
+
+// BuildOne 转换单条对话
+func (b *PostDialogueBuilder) BuildOne(dialogue model.PreDialogue) model.PostDialogue {
+	text := spokenText(dialogue)
+	post := model.PostDialogue{
+		PreDialogue: dialogue,
+		TextLang:    utils.DetectLanguage(text).TTSLang(),
+		OutputPath:  b.outputPath(dialogue),
+		Status:      model.PostDialoguePending,
+	}
+
+	subDir, ok := b.findSubDir(dialogue)
+	if !ok {
+		post.Status = model.PostDialogueSkipped
+		post.Error = fmt.Sprintf("未找到角色 %s 的参考音频", dialogue.Id)
+		return post
+	}
+
+	tone, ok := b.pickTone(subDir, dialogue.Tone)
+	if !ok {
+		post.Status = model.PostDialogueSkipped
+		post.Error = fmt.Sprintf("角色 %s 没有可用的语气参考音频", dialogue.Id)
+		return post
+	}
+
+	post.ResolvedTone = tone.Tone
+	post.RefAudioPath = tone.Paths[0].Path
+	post.PromptText = promptTextFromPath(post.RefAudioPath)
+	post.PromptLang = utils.DetectLanguage(post.PromptText).TTSLang()
+
+	post.TTS = model.DefaultTTSRequest(text, post.TextLang, post.RefAudioPath, post.PromptLang)
+	post.TTS.PromptText = post.PromptText
+
+	return post
+}
+
+// spokenText 返回用于合成的文本，没有朗读文本时使用显示文本
+func spokenText(dialogue model.PreDialogue) string {
+	if dialogue.SpokenText != "" {
+		return dialogue.SpokenText
+	}
+	return dialogue.Text
+}
+
+// findSubDir 按角色ID（或名称）和AudioId查找参考音频目录
+func (b *PostDialogueBuilder) findSubDir(dialogue model.PreDialogue) (utils.AudioRefSubDir, bool) {
+	return utils.FindAudioRefSubDir(b.refs, dialogue.Id, dialogue.Name, dialogue.AudioId)
+}
+
+// pickTone 选择语气，找不到对应语气时依次回退到默认语气和第一个语气
+func (b *PostDialogueBuilder) pickTone(subDir utils.AudioRefSubDir, tone string) (utils.AudioRefTone, bool) {
+	if len(subDir.Tones) == 0 {
+		return utils.AudioRefTone{}, false
+	}
+	for _, candidate := range []string{tone, b.DefaultTone} {
+		if candidate == "" {
+			continue
+		}
+		for _, t := range subDir.Tones {
+			if t.Tone == candidate {
+				return t, true
+			}
+		}
+	}
+	return subDir.Tones[0], true
+}
+
+// outputPath 生成输出音频路径，格式为 <场景>_<角色ID>_<行号>.wav
+// step 只在各自的脚本内唯一，加上场景文件名避免多个场景写入同一输出目录时互相覆盖；没有来源位置时省略场景
+func (b *PostDialogueBuilder) outputPath(dialogue model.PreDialogue) string {
+	name := fmt.Sprintf("%s_%d.wav", dialogue.Id, dialogue.Step)
+	if scene := sceneStem(dialogue.Source); scene != "" {
+		name = scene + "_" + name
+	}
+	return filepath.ToSlash(filepath.Join(b.outputDir, name))
+}
+
+// sceneStem 返回对话所在脚本去掉扩展名的文件名
+func sceneStem(source *model.SourcePos) string {
+	if source == nil || source.File == "" {
+		return ""
+	}
+	name := filepath.Base(filepath.FromSlash(source.File))
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// promptTextFromPath 参考音频按GPT-SoVITS惯例以提示文本命名，去掉扩展名即为提示文本
+func promptTextFromPath(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
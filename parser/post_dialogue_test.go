@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"myvoicego/model"
+	"reflect"
+	"testing"
+)
+
+func TestPostDialogueOutputPath(t *testing.T) {
+	source := func(file string) *model.SourcePos {
+		return &model.SourcePos{File: file}
+	}
+
+	tests := []struct {
+		name      string
+		dialogues []model.PreDialogue
+		want      []string
+	}{
+		{
+			name: "加上场景文件名",
+			dialogues: []model.PreDialogue{
+				{Id: "soyo", Step: 3, Source: source("game/scene/start.txt")},
+			},
+			want: []string{"output/start_soyo_3.wav"},
+		},
+		{
+			name: "不同场景的相同行号不冲突",
+			dialogues: []model.PreDialogue{
+				{Id: "soyo", Step: 3, Source: source("game/scene/start.txt")},
+				{Id: "soyo", Step: 3, Source: source("game/scene/chapter1.txt")},
+			},
+			want: []string{"output/start_soyo_3.wav", "output/chapter1_soyo_3.wav"},
+		},
+		{
+			name: "不同目录下的同名场景加序号",
+			dialogues: []model.PreDialogue{
+				{Id: "soyo", Step: 3, Source: source("game/scene/end.txt")},
+				{Id: "soyo", Step: 3, Source: source("game/scene/sub/end.txt")},
+				{Id: "soyo", Step: 3, Source: source("game/scene/other/end.txt")},
+			},
+			want: []string{"output/end_soyo_3.wav", "output/end_soyo_3_2.wav", "output/end_soyo_3_3.wav"},
+		},
+		{
+			name: "没有来源位置时省略场景",
+			dialogues: []model.PreDialogue{
+				{Id: "anon", Step: 0},
+			},
+			want: []string{"output/anon_0.wav"},
+		},
+	}
+
+	builder := NewPostDialogueBuilder(nil, "output")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, post := range builder.Build(tt.dialogues) {
+				got = append(got, post.OutputPath)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OutputPath = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
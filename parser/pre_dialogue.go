@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"myvoicego/model"
+	"myvoicego/utils"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -16,11 +18,42 @@ const (
 	UnknownLine LineType = iota
 	FigureChangeLine
 	DialogueLine
+	NarrationLine
+	SceneChangeLine
+	BackgroundChangeLine
+)
+
+// 未指定 -id 的立绘所使用的默认位置，与WebGAL内部的立绘键一致
+const (
+	FigureSlotLeft   = "fig-left"
+	FigureSlotCenter = "fig-center"
+	FigureSlotRight  = "fig-right"
+
+	// FigureNone 关闭立绘的内容值
+	FigureNone = "none"
 )
 
 type DialogueParser struct {
 	figures    []model.PreDialogue
 	tempFigure map[string]model.PreDialogue
+
+	// 当前说话人，用于没有写出说话人的续行
+	speaker         string
+	speakerFigureId string
+
+	// 角色表，用于在缺少 -figureId 时按名称识别说话人
+	registry *utils.CharacterRegistry
+
+	// 文本中 {var} 的替换值
+	variables map[string]string
+
+	// 当前背景，由 changeBg 设置
+	background string
+
+	// 源码位置与诊断信息
+	file        string
+	lineOffset  int
+	diagnostics []Diagnostic
 }
 
 // NewDialogueParser 创建新的对话解析器
@@ -31,140 +64,289 @@ func NewDialogueParser() *DialogueParser {
 	}
 }
 
+// SetCharacterRegistry 设置角色表
+func (p *DialogueParser) SetCharacterRegistry(registry *utils.CharacterRegistry) {
+	p.registry = registry
+}
+
+// SetVariables 设置生成朗读文本时 {var} 的替换值
+func (p *DialogueParser) SetVariables(variables map[string]string) {
+	p.variables = variables
+}
+
+// SetFile 设置当前解析的脚本文件名，用于源码位置和诊断信息
+func (p *DialogueParser) SetFile(file string) {
+	p.file = file
+}
+
+// ParseScript 逐行解析整个脚本，行号（从0开始）即为step
+func (p *DialogueParser) ParseScript(content string) {
+	offset := 0
+	for step, line := range SplitScriptLines(content) {
+		p.lineOffset = offset
+		p.ParseDialogue(line, step)
+		offset += len(line) + 1
+	}
+	p.lineOffset = 0
+}
+
+// ParseFile 读取并解析脚本文件
+func (p *DialogueParser) ParseFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取脚本文件失败: %v", err)
+	}
+	p.SetFile(path)
+	p.ParseScript(string(content))
+	return nil
+}
+
+// SplitScriptLines 按行切分脚本，与WebGAL一致每行一条语句，保留行尾的\r
+func SplitScriptLines(content string) []string {
+	return strings.Split(content, "\n")
+}
+
 // ParseDialogue 解析对话
 func (p *DialogueParser) ParseDialogue(line string, step int) {
-	line = strings.TrimSpace(line)
-	if line == "" {
+	stmt := ParseStatement(line)
+	if stmt.IsEmpty() {
 		return
 	}
 
-	lineType := p.detectLineType(line)
+	p.checkArgs(stmt, step)
+
+	lineType := p.detectLineType(stmt)
 	switch lineType {
 	case FigureChangeLine:
-		p.parseFigureChange(line, step)
+		p.parseFigureChange(stmt, step)
 	case DialogueLine:
-		p.parseDialogueLine(line, step)
+		p.parseDialogueLine(stmt, step)
+	case NarrationLine:
+		p.resetSpeaker()
+	case SceneChangeLine:
+		p.enterScene()
+		p.background = ""
+	case BackgroundChangeLine:
+		p.enterScene()
+		p.background = strings.TrimSpace(stmt.Content)
+		if p.background == FigureNone {
+			p.background = ""
+		}
 	}
 }
 
 // detectLineType 检测行类型
-func (p *DialogueParser) detectLineType(line string) LineType {
-	if strings.HasPrefix(line, "changeFigure:") {
+func (p *DialogueParser) detectLineType(stmt *Statement) LineType {
+	if stmt.Command == CommandChangeFigure {
 		return FigureChangeLine
 	}
-	if strings.Contains(line, "-figureId=") {
+	if stmt.Command == CommandChangeScene {
+		return SceneChangeLine
+	}
+	if stmt.Command == CommandChangeBg {
+		return BackgroundChangeLine
+	}
+	if stmt.IsSay() {
+		// ":文本" 为旁白，没有说话人
+		if stmt.HasSpeaker && stmt.Speaker == "" {
+			return NarrationLine
+		}
 		return DialogueLine
 	}
 	return UnknownLine
 }
 
 // parseFigureChange 解析角色变更
-func (p *DialogueParser) parseFigureChange(line string, step int) {
-	if !p.isValidFigureChangeLine(line) {
-		return
-	}
-
-	parts := p.lineToParts(line)
-	var figureId string
-
-	// 首先获取figureId
-	for _, part := range parts {
-		if strings.HasPrefix(part, "-id=") {
-			figureId = strings.TrimPrefix(part, "-id=")
-			break
-		}
-	}
+// -next 只影响演出时是否立即执行下一句，对立绘状态没有影响，按顺序应用即可
+func (p *DialogueParser) parseFigureChange(stmt *Statement, step int) {
+	figureId := p.figureKey(stmt)
 
-	if figureId == "" {
+	// changeFigure:none 关闭立绘
+	if stmt.Content == FigureNone {
+		delete(p.tempFigure, figureId)
 		return
 	}
 
-	// 获取已存在的figure或创建新的
 	figure, exists := p.tempFigure[figureId]
 	if !exists {
-		figure = model.PreDialogue{Step: step}
-	} else {
-		figure.Step = step
+		// 内容为空的changeFigure只调整已在场立绘的参数
+		if stmt.Content == "" {
+			p.warn(DiagUnknownFigure, p.position(step, 0, stmt.BodyEnd),
+				"立绘 %s 不在场，忽略对其参数的调整", figureId)
+			return
+		}
+		figure = model.PreDialogue{Id: figureId}
+	} else if stmt.Content != "" && stmt.Content != figure.Model {
+		if !p.sameCharacter(figure.Model, stmt.Content) {
+			p.warn(DiagDuplicateId, p.position(step, stmt.ContentStart, stmt.ContentEnd),
+				"立绘ID %s 已被 %s 使用，将被 %s 替换", figureId, figure.Model, stmt.Content)
+		}
+		// 更换了立绘模型，之前的动作、表情和AudioId不再有效
+		figure.Motion = ""
+		figure.Expression = ""
+		figure.AudioId = ""
 	}
+	figure.Step = step
 
 	// 只更新changeFigure行中指定的字段
-	for _, part := range parts {
-		p.parseFigurePart(&figure, part)
-	}
+	p.applyFigureChange(&figure, stmt)
 
 	// 更新tempFigure
 	p.tempFigure[figureId] = figure
 }
 
-// isValidFigureChangeLine 检查是否为有效的角色变更行
-func (p *DialogueParser) isValidFigureChangeLine(line string) bool {
-	return strings.Contains(line, "-motion=") || strings.Contains(line, "-expression=")
+// sameCharacter 判断两个立绘模型路径是否属于同一角色（如仅更换服装）
+func (p *DialogueParser) sameCharacter(modelA, modelB string) bool {
+	if a, b := p.registry.ResolveFigureModel(modelA), p.registry.ResolveFigureModel(modelB); a != "" || b != "" {
+		return a == b
+	}
+	dirA, _, _ := strings.Cut(modelA, "/")
+	dirB, _, _ := strings.Cut(modelB, "/")
+	return dirA == dirB
 }
 
-// parseFigurePart 解析角色部分
-func (p *DialogueParser) parseFigurePart(figure *model.PreDialogue, part string) {
+// figureKey 获取立绘的键，未指定 -id 时使用 -left/-right/-center 默认位置
+func (p *DialogueParser) figureKey(stmt *Statement) string {
+	if id := stmt.ArgValue("id"); id != "" {
+		return id
+	}
 	switch {
-	case strings.HasPrefix(part, "changeFigure:"):
-		figure.Model = strings.TrimPrefix(part, "changeFigure:")
-	case strings.HasPrefix(part, "-id="):
-		figure.Id = strings.TrimPrefix(part, "-id=")
-	case strings.HasPrefix(part, "-motion="):
-		figure.Motion = strings.TrimPrefix(part, "-motion=")
-	case strings.HasPrefix(part, "-expression="):
-		figure.Expression = strings.TrimPrefix(part, "-expression=")
+	case stmt.HasArg("left"):
+		return FigureSlotLeft
+	case stmt.HasArg("right"):
+		return FigureSlotRight
+	default:
+		return FigureSlotCenter
+	}
+}
+
+// applyFigureChange 将changeFigure语句中的字段应用到角色
+func (p *DialogueParser) applyFigureChange(figure *model.PreDialogue, stmt *Statement) {
+	if stmt.Content != "" {
+		figure.Model = stmt.Content
+	}
+	for _, arg := range stmt.Args {
+		switch arg.Key {
+		case "id":
+			figure.Id = arg.Value
+		case "motion":
+			figure.Motion = arg.Value
+		case "expression":
+			figure.Expression = arg.Value
+		case "audioId":
+			figure.AudioId = arg.Value
+		}
 	}
 }
 
-// parseDialogue 解析对话内容
-func (p *DialogueParser) parseDialogueLine(line string, step int) {
-	dialogueText, figureId := p.extractDialogueInfo(line)
-	if dialogueText == "" || figureId == "" {
+// parseDialogueLine 解析对话内容
+func (p *DialogueParser) parseDialogueLine(stmt *Statement, step int) {
+	name, figureId := p.resolveSpeaker(stmt)
+	if stmt.Content == "" {
 		return
 	}
 
-	name, text := p.extractNameAndText(dialogueText)
+	pos := p.position(step, stmt.ContentStart, stmt.ContentEnd)
+	if figureId == "" {
+		speaker := name
+		if speaker == "" {
+			speaker = "（无）"
+		}
+		p.warn(DiagNoActiveFigure, pos, "对话没有在场立绘，且无法识别说话人 %s", speaker)
+		return
+	}
 
-	if figure, exists := p.tempFigure[figureId]; exists {
-		updatedFigure := p.updateFigure(figure, text, name, step)
-		p.addOrUpdateFigure(updatedFigure, figureId)
+	figure, exists := p.tempFigure[figureId]
+	if !exists {
+		// 立绘不在场，但说话人可以通过角色表识别时仍然生成对话
+		if p.registry.ResolveID(name) != figureId {
+			p.warn(DiagUnknownFigure, pos, "立绘 %s 不在场", figureId)
+			return
+		}
+		figure = model.PreDialogue{Id: figureId}
 	}
-}
 
-// extractDialogueInfo 提取对话信息
-func (p *DialogueParser) extractDialogueInfo(line string) (string, string) {
-	parts := p.lineToParts(line)
-	if len(parts) <= 1 {
-		return "", ""
+	// 立绘ID不是角色ID时（如 -id=1），按立绘模型路径归属到角色
+	if characterId := p.registry.ResolveFigureModel(figure.Model); characterId != "" {
+		figure.Id = characterId
 	}
 
-	dialogueText := parts[0]
-	figureId := p.extractFigureId(parts)
+	spoken, undefined := normalizeSpokenText(stmt.Content, p.variables)
+	for _, variable := range undefined {
+		p.warn(DiagUndefinedVar, pos, "变量 %s 未定义，将按原名朗读", variable)
+	}
 
-	return dialogueText, figureId
+	updatedFigure := p.updateFigure(figure, stmt.Content, name, step)
+	updatedFigure.SpokenText = spoken
+	// -voiceModel 只对当前这句对话生效
+	updatedFigure.ModelVariant = stmt.ArgValue("voiceModel")
+	updatedFigure.Background = p.background
+	if p.file != "" {
+		updatedFigure.Scene = filepath.Base(p.file)
+	}
+	updatedFigure.Source = &pos
+	p.addOrUpdateFigure(updatedFigure, figureId)
 }
 
-// extractFigureId 提取角色ID
-func (p *DialogueParser) extractFigureId(parts []string) string {
-	for _, part := range parts {
-		if strings.HasPrefix(part, "-figureId=") {
-			return strings.TrimPrefix(part, "-figureId=")
+// resolveSpeaker 确定对话的说话人和角色ID，没有说话人的续行沿用上一位说话人
+func (p *DialogueParser) resolveSpeaker(stmt *Statement) (string, string) {
+	figureId := stmt.ArgValue("figureId")
+
+	if stmt.HasSpeaker {
+		// 换了说话人时不再沿用之前的角色ID
+		if stmt.Speaker != p.speaker {
+			p.speakerFigureId = ""
 		}
+		p.speaker = stmt.Speaker
+	}
+
+	if figureId != "" {
+		p.speakerFigureId = figureId
+	}
+
+	// 没有 -figureId 时按说话人名称查找角色
+	if p.speakerFigureId == "" && p.speaker != "" {
+		p.speakerFigureId = p.figureIdForSpeaker(p.speaker)
 	}
-	return ""
+
+	return p.speaker, p.speakerFigureId
 }
 
-// extractNameAndText 提取名称和文本
-func (p *DialogueParser) extractNameAndText(dialogueText string) (string, string) {
-	if !strings.Contains(dialogueText, ":") {
-		return "", dialogueText
+// figureIdForSpeaker 根据说话人名称查找对应的立绘ID，立绘不在场时返回角色ID
+func (p *DialogueParser) figureIdForSpeaker(name string) string {
+	characterId := p.registry.ResolveID(name)
+	if characterId == "" {
+		return ""
+	}
+	if _, exists := p.tempFigure[characterId]; exists {
+		return characterId
 	}
 
-	parts := strings.SplitN(dialogueText, ":", 2)
-	if len(parts) < 2 {
-		return "", dialogueText
+	// 按立绘模型路径匹配，按ID排序保证结果稳定
+	figureIds := make([]string, 0, len(p.tempFigure))
+	for id := range p.tempFigure {
+		figureIds = append(figureIds, id)
+	}
+	sort.Strings(figureIds)
+	for _, id := range figureIds {
+		if p.registry.ResolveFigureModel(p.tempFigure[id].Model) == characterId {
+			return id
+		}
 	}
 
-	return parts[0], parts[1]
+	return characterId
+}
+
+// resetSpeaker 清除当前说话人
+func (p *DialogueParser) resetSpeaker() {
+	p.speaker = ""
+	p.speakerFigureId = ""
+}
+
+// enterScene 进入新场景（changeBg/changeScene），清空在场立绘和当前说话人
+func (p *DialogueParser) enterScene() {
+	p.tempFigure = make(map[string]model.PreDialogue)
+	p.resetSpeaker()
 }
 
 // updateFigure 更新角色信息
@@ -179,8 +361,8 @@ func (p *DialogueParser) updateFigure(figure model.PreDialogue, text, name strin
 
 // addOrUpdateFigure 添加或更新角色
 func (p *DialogueParser) addOrUpdateFigure(figure model.PreDialogue, figureId string) {
-	// 更新临时存储
-	if figure.Name != "" {
+	// 更新临时存储，不在场的立绘不写入
+	if _, onStage := p.tempFigure[figureId]; onStage && figure.Name != "" {
 		p.tempFigure[figureId] = figure
 	}
 
@@ -196,11 +378,9 @@ func (p *DialogueParser) addOrUpdateFigure(figure model.PreDialogue, figureId st
 	}
 }
 
-// lineToParts 行裁剪器
-func (p *DialogueParser) lineToParts(line string) []string {
-	line = strings.TrimSuffix(line, ";")
-	content := strings.TrimSpace(line)
-	return strings.Fields(content)
+// Dialogues 返回已解析的对话列表
+func (p *DialogueParser) Dialogues() []model.PreDialogue {
+	return p.figures
 }
 
 // ExportFiguresToJSON 将figures按照id分类并分别保存到JSON文件中
@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WebGAL 工程目录约定
+const (
+	SceneDirName   = "scene"
+	EntrySceneName = "start.txt"
+	SceneExt       = ".txt"
+)
+
+// DiagMissingScene 跳转的目标场景不存在
+const DiagMissingScene DiagnosticCode = "missing-scene"
+
+// SceneLink 场景之间的跳转
+type SceneLink struct {
+	Command string          // changeScene、callScene 或 choose
+	Target  string          // 目标场景文件名
+	Pos     model.SourcePos // 跳转语句的位置
+}
+
+// SceneResult 单个场景的解析结果
+type SceneResult struct {
+	Name        string              // 场景文件名，如 start.txt
+	Path        string              // 场景文件路径
+	Dialogues   []model.PreDialogue // 场景中的对话
+	Diagnostics []Diagnostic        // 场景中的诊断信息
+	Links       []SceneLink         // 场景中的跳转
+}
+
+// Project WebGAL工程的解析结果
+type Project struct {
+	GameDir     string
+	SceneDir    string
+	Scenes      []SceneResult // 从入口场景可达的场景，按发现顺序排列
+	Unreachable []string      // 场景目录中无法从入口到达的场景
+	Diagnostics []Diagnostic  // 工程级诊断信息，如跳转目标不存在
+}
+
+// LoadProject 从WebGAL游戏目录（包含 scene/start.txt）加载并解析所有可达场景，variables 为文本变量的朗读值，可为空
+func LoadProject(gameDir string, registry *utils.CharacterRegistry, variables map[string]string) (*Project, error) {
+	sceneDir := filepath.Join(gameDir, SceneDirName)
+	if _, err := os.Stat(filepath.Join(sceneDir, EntrySceneName)); err != nil {
+		return nil, fmt.Errorf("未找到入口场景 %s: %v", filepath.Join(sceneDir, EntrySceneName), err)
+	}
+
+	project := &Project{
+		GameDir:  gameDir,
+		SceneDir: sceneDir,
+	}
+
+	// 从入口场景开始广度优先遍历
+	visited := map[string]bool{EntrySceneName: true}
+	queue := []string{EntrySceneName}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		scene, err := parseScene(sceneDir, name, registry, variables)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range scene.Links {
+			target := normalizeSceneName(link.Target)
+			if visited[target] {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(sceneDir, filepath.FromSlash(target))); err != nil {
+				project.Diagnostics = append(project.Diagnostics, Diagnostic{
+					Severity: SeverityError,
+					Code:     DiagMissingScene,
+					Message:  fmt.Sprintf("%s 的目标场景 %s 不存在", link.Command, link.Target),
+					Pos:      link.Pos,
+				})
+				continue
+			}
+			visited[target] = true
+			queue = append(queue, target)
+		}
+
+		project.Scenes = append(project.Scenes, scene)
+	}
+
+	unreachable, err := listUnreachableScenes(sceneDir, visited)
+	if err != nil {
+		return nil, err
+	}
+	project.Unreachable = unreachable
+
+	return project, nil
+}
+
+// normalizeSceneName 统一场景路径的写法（./a.txt、sub\b.txt），与 listUnreachableScenes 使用的相对路径一致
+func normalizeSceneName(name string) string {
+	return path.Clean(strings.ReplaceAll(name, "\\", "/"))
+}
+
+// Dialogues 返回所有可达场景的对话，来源场景记录在 Source.File 中
+func (p *Project) Dialogues() []model.PreDialogue {
+	var dialogues []model.PreDialogue
+	for _, scene := range p.Scenes {
+		dialogues = append(dialogues, scene.Dialogues...)
+	}
+	return dialogues
+}
+
+// AllDiagnostics 返回工程级和各场景的全部诊断信息
+func (p *Project) AllDiagnostics() []Diagnostic {
+	diagnostics := append([]Diagnostic(nil), p.Diagnostics...)
+	for _, scene := range p.Scenes {
+		diagnostics = append(diagnostics, scene.Diagnostics...)
+	}
+	return diagnostics
+}
+
+// parseScene 解析单个场景文件，并收集其中的跳转
+func parseScene(sceneDir, name string, registry *utils.CharacterRegistry, variables map[string]string) (SceneResult, error) {
+	path := filepath.Join(sceneDir, name)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return SceneResult{}, fmt.Errorf("读取场景文件失败: %v", err)
+	}
+
+	p := NewDialogueParser()
+	p.SetCharacterRegistry(registry)
+	p.SetVariables(variables)
+	p.SetFile(path)
+	p.ParseScript(string(content))
+
+	return SceneResult{
+		Name:        name,
+		Path:        path,
+		Dialogues:   p.Dialogues(),
+		Diagnostics: p.Diagnostics(),
+		Links:       sceneLinks(path, string(content)),
+	}, nil
+}
+
+// sceneLinks 收集脚本中 changeScene/callScene/choose 的目标场景
+func sceneLinks(file, content string) []SceneLink {
+	var links []SceneLink
+	offset := 0
+	for step, line := range SplitScriptLines(content) {
+		stmt := ParseStatement(line)
+		pos := model.SourcePos{
+			File:   file,
+			Line:   step + 1,
+			Column: stmt.ContentStart + 1,
+			Offset: offset + stmt.ContentStart,
+			End:    offset + stmt.ContentEnd,
+		}
+		offset += len(line) + 1
+
+		switch stmt.Command {
+		case CommandChangeScene, CommandCallScene:
+			if target := strings.TrimSpace(stmt.Content); target != "" {
+				links = append(links, SceneLink{Command: stmt.Command, Target: target, Pos: pos})
+			}
+		case CommandChoose:
+			for _, target := range chooseTargets(stmt.Content) {
+				links = append(links, SceneLink{Command: stmt.Command, Target: target, Pos: pos})
+			}
+		}
+	}
+	return links
+}
+
+// chooseTargets 解析 choose:选项A:a.txt|选项B:label 中指向场景文件的目标，标签跳转被忽略
+func chooseTargets(content string) []string {
+	var targets []string
+	for _, option := range strings.Split(content, "|") {
+		i := strings.LastIndex(option, ":")
+		if i < 0 {
+			continue
+		}
+		target := strings.TrimSpace(option[i+1:])
+		if strings.HasSuffix(target, SceneExt) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// listUnreachableScenes 列出场景目录中未被访问到的场景
+func listUnreachableScenes(sceneDir string, visited map[string]bool) ([]string, error) {
+	var unreachable []string
+	err := filepath.WalkDir(sceneDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != SceneExt {
+			return nil
+		}
+		rel, err := filepath.Rel(sceneDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !visited[rel] {
+			unreachable = append(unreachable, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("遍历场景目录失败: %v", err)
+	}
+	sort.Strings(unreachable)
+	return unreachable, nil
+}
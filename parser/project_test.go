@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeScenes 在临时游戏目录的 scene 目录下写入场景文件，返回游戏目录
+func writeScenes(t *testing.T, scenes map[string]string) string {
+	t.Helper()
+	gameDir := t.TempDir()
+	for name, content := range scenes {
+		path := filepath.Join(gameDir, SceneDirName, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return gameDir
+}
+
+func TestLoadProject(t *testing.T) {
+	tests := []struct {
+		name        string
+		scenes      map[string]string
+		want        []string // 按发现顺序排列的可达场景
+		unreachable []string
+		missing     int // 目标不存在的跳转数
+	}{
+		{
+			name: "广度优先遍历跳转",
+			scenes: map[string]string{
+				"start.txt":    "changeScene:a.txt;\ncallScene:b.txt;\n",
+				"a.txt":        "changeScene:c.txt;\n",
+				"b.txt":        "end;\n",
+				"c.txt":        "end;\n",
+				"unused.txt":   "end;\n",
+				"sub/lone.txt": "end;\n",
+			},
+			want:        []string{"start.txt", "a.txt", "b.txt", "c.txt"},
+			unreachable: []string{"sub/lone.txt", "unused.txt"},
+		},
+		{
+			name: "选项跳转和子目录",
+			scenes: map[string]string{
+				"start.txt":     "choose:去A:./sub/a.txt|留下:stay|去B:sub\\b.txt;\n",
+				"sub/a.txt":     "end;\n",
+				"sub/b.txt":     "end;\n",
+				"sub/other.txt": "end;\n",
+			},
+			want:        []string{"start.txt", "sub/a.txt", "sub/b.txt"},
+			unreachable: []string{"sub/other.txt"},
+		},
+		{
+			name: "循环跳转只访问一次",
+			scenes: map[string]string{
+				"start.txt": "changeScene:a.txt;\n",
+				"a.txt":     "changeScene:start.txt;\ncallScene:a.txt;\n",
+			},
+			want: []string{"start.txt", "a.txt"},
+		},
+		{
+			name: "目标场景不存在",
+			scenes: map[string]string{
+				"start.txt": "changeScene:missing.txt;\nchoose:A:gone.txt|B:a.txt;\n",
+				"a.txt":     "end;\n",
+			},
+			want:    []string{"start.txt", "a.txt"},
+			missing: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, err := LoadProject(writeScenes(t, tt.scenes), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, scene := range project.Scenes {
+				names = append(names, scene.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Scenes = %v, want %v", names, tt.want)
+			}
+			if !reflect.DeepEqual(project.Unreachable, tt.unreachable) {
+				t.Errorf("Unreachable = %v, want %v", project.Unreachable, tt.unreachable)
+			}
+			missing := 0
+			for _, diag := range project.Diagnostics {
+				if diag.Code == DiagMissingScene {
+					missing++
+				}
+			}
+			if missing != tt.missing {
+				t.Errorf("缺失场景诊断 %d 条, want %d", missing, tt.missing)
+			}
+		})
+	}
+}
+
+func TestLoadProjectDialogueSource(t *testing.T) {
+	gameDir := writeScenes(t, map[string]string{
+		"start.txt":  "changeFigure:anon.json -id=anon;\nanon:开始了 -figureId=anon;\nchangeScene:sub/b.txt;\n",
+		"sub/b.txt":  "changeFigure:soyo.json -id=soyo;\nsoyo:到了 -figureId=soyo;\n",
+		"lonely.txt": "changeFigure:taki.json -id=taki;\ntaki:没人来 -figureId=taki;\n",
+	})
+	project, err := LoadProject(gameDir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, d := range project.Dialogues() {
+		rel, err := filepath.Rel(gameDir, d.Source.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.ToSlash(rel)+":"+d.Text)
+	}
+	// 无法到达的场景不生成对话
+	if want := []string{"scene/start.txt:开始了", "scene/sub/b.txt:到了"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("对话 = %v, want %v", got, want)
+	}
+}
+
+func TestLoadProjectMissingEntry(t *testing.T) {
+	if _, err := LoadProject(writeScenes(t, map[string]string{"a.txt": "end;\n"}), nil, nil); err == nil {
+		t.Error("没有入口场景时应返回错误")
+	}
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DiagUndefinedVar 文本中引用了未提供的变量
+const DiagUndefinedVar DiagnosticCode = "undefined-var"
+
+// DefaultVariablesConfig 文本变量配置文件的默认路径，内容为 {"变量名": "朗读时的值"}
+var DefaultVariablesConfig = filepath.Join("config", "variables.json")
+
+// LoadVariables 读取文本变量配置，路径为空或文件不存在时返回空表
+func LoadVariables(path string) (map[string]string, error) {
+	variables := make(map[string]string)
+	if path == "" {
+		return variables, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return variables, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取变量配置失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &variables); err != nil {
+		return nil, fmt.Errorf("解析变量配置失败: %v", err)
+	}
+	return variables, nil
+}
+
+var (
+	// rubyRegex 匹配注音/注释标记 [漢字](かんじ) 或 [文本](style=... ruby=...)
+	rubyRegex = regexp.MustCompile(`\[([^\[\]]*)\]\(([^()]*)\)`)
+	// variableRegex 匹配变量插值 {var}
+	variableRegex = regexp.MustCompile(`\{([^{}]*)\}`)
+	// tagRegex 匹配 <color=#fff>、</color> 之类的标签
+	tagRegex = regexp.MustCompile(`</?[A-Za-z][^<>]*>`)
+)
+
+// NormalizeSpokenText 将WebGAL显示文本转换为用于语音合成的文本：
+// 变量替换为给定的值，注音替换为读音，去除标签和 | 换行
+func NormalizeSpokenText(text string, vars map[string]string) string {
+	spoken, _ := normalizeSpokenText(text, vars)
+	return spoken
+}
+
+// normalizeSpokenText 同 NormalizeSpokenText，同时返回未定义的变量名
+func normalizeSpokenText(text string, vars map[string]string) (string, []string) {
+	var undefined []string
+
+	text = variableRegex.ReplaceAllStringFunc(text, func(m string) string {
+		name := strings.TrimSpace(m[1 : len(m)-1])
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		undefined = append(undefined, name)
+		return name
+	})
+
+	text = rubyRegex.ReplaceAllStringFunc(text, func(m string) string {
+		sub := rubyRegex.FindStringSubmatch(m)
+		return rubyReading(sub[1], sub[2])
+	})
+
+	text = tagRegex.ReplaceAllString(text, "")
+	text = joinLineBreaks(text)
+
+	return strings.TrimSpace(text), undefined
+}
+
+// rubyReading 返回注音标记应读出的文本
+// 注释部分不含'='时整体即为读音；否则查找 ruby= 项，没有读音时读原文
+func rubyReading(base, annotation string) string {
+	if !strings.Contains(annotation, "=") {
+		if reading := strings.TrimSpace(annotation); reading != "" {
+			return reading
+		}
+		return base
+	}
+
+	for _, item := range strings.FieldsFunc(annotation, func(r rune) bool {
+		return r == ' ' || r == ';'
+	}) {
+		key, value, ok := strings.Cut(item, "=")
+		if ok && strings.TrimSpace(key) == "ruby" && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return base
+}
+
+// joinLineBreaks 去除 | 换行符，两侧都是英文或数字时保留一个空格
+func joinLineBreaks(text string) string {
+	if !strings.Contains(text, "|") {
+		return text
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '|' {
+			sb.WriteByte(text[i])
+			continue
+		}
+		if i > 0 && i+1 < len(text) && isASCIIWord(text[i-1]) && isASCIIWord(text[i+1]) {
+			sb.WriteByte(' ')
+		}
+	}
+	return sb.String()
+}
+
+// isASCIIWord 判断是否为英文字母或数字
+func isASCIIWord(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
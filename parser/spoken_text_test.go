@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSpokenText(t *testing.T) {
+	vars := map[string]string{"name": "素世", "count": "三"}
+
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		undefined []string
+	}{
+		{name: "普通文本", text: "你好", want: "你好"},
+		{name: "注音读音", text: "[漢字](かんじ)を読む", want: "かんじを読む"},
+		{name: "ruby参数", text: "[東京](style=color:red ruby=とうきょう)へ", want: "とうきょうへ"},
+		{name: "ruby参数以分号分隔", text: "[東京](style=bold;ruby=とうきょう)", want: "とうきょう"},
+		{name: "没有读音时读原文", text: "[重要](style=color:red)的事", want: "重要的事"},
+		{name: "空注音读原文", text: "[原文]( )", want: "原文"},
+		{name: "变量替换", text: "{name}买了{ count }个", want: "素世买了三个"},
+		{name: "变量作为注音原文", text: "[{name}](そよ)", want: "そよ"},
+		{name: "未定义的变量读变量名", text: "{player}来了", want: "player来了", undefined: []string{"player"}},
+		{name: "去除标签", text: "<color=#f00>红色</color>文字", want: "红色文字"},
+		{name: "中文换行直接拼接", text: "第一行|第二行", want: "第一行第二行"},
+		{name: "英文换行保留空格", text: "hello|world", want: "hello world"},
+		{name: "去除两端空白", text: "  [嗯](えん)  ", want: "えん"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, undefined := normalizeSpokenText(tt.text, vars)
+			if got != tt.want {
+				t.Errorf("normalizeSpokenText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if !reflect.DeepEqual(undefined, tt.undefined) {
+				t.Errorf("undefined = %v, want %v", undefined, tt.undefined)
+			}
+		})
+	}
+}
+
+func TestLoadVariables(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "variables.json")
+	if err := os.WriteFile(valid, []byte(`{"name": "素世"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`["name"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "读取配置", path: valid, want: map[string]string{"name": "素世"}},
+		{name: "路径为空", path: "", want: map[string]string{}},
+		{name: "文件不存在", path: filepath.Join(dir, "missing.json"), want: map[string]string{}},
+		{name: "格式错误", path: invalid, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadVariables(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadVariables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
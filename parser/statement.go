@@ -0,0 +1,337 @@
+package parser
+
+import (
+	"strings"
+)
+
+// WebGAL 命令常量
+const (
+	CommandSay                 = "say"
+	CommandChangeBg            = "changeBg"
+	CommandChangeFigure        = "changeFigure"
+	CommandBgm                 = "bgm"
+	CommandPlayVideo           = "playVideo"
+	CommandPixiPerform         = "pixiPerform"
+	CommandPixiInit            = "pixiInit"
+	CommandIntro               = "intro"
+	CommandMiniAvatar          = "miniAvatar"
+	CommandChangeScene         = "changeScene"
+	CommandCallScene           = "callScene"
+	CommandChoose              = "choose"
+	CommandEnd                 = "end"
+	CommandSetComplexAnimation = "setComplexAnimation"
+	CommandSetFilter           = "setFilter"
+	CommandLabel               = "label"
+	CommandJumpLabel           = "jumpLabel"
+	CommandSetVar              = "setVar"
+	CommandShowVars            = "showVars"
+	CommandUnlockCg            = "unlockCg"
+	CommandUnlockBgm           = "unlockBgm"
+	CommandFilmMode            = "filmMode"
+	CommandSetTextbox          = "setTextbox"
+	CommandSetAnimation        = "setAnimation"
+	CommandPlayEffect          = "playEffect"
+	CommandSetTempAnimation    = "setTempAnimation"
+	CommandSetTransform        = "setTransform"
+	CommandSetTransition       = "setTransition"
+	CommandGetUserInput        = "getUserInput"
+	CommandApplyStyle          = "applyStyle"
+	CommandWait                = "wait"
+	CommandCallSteam           = "callSteam"
+)
+
+// knownCommands WebGAL内置命令集合，冒号前不在此集合中的内容视为说话人
+var knownCommands = map[string]struct{}{
+	CommandSay: {}, CommandChangeBg: {}, CommandChangeFigure: {}, CommandBgm: {},
+	CommandPlayVideo: {}, CommandPixiPerform: {}, CommandPixiInit: {}, CommandIntro: {},
+	CommandMiniAvatar: {}, CommandChangeScene: {}, CommandCallScene: {}, CommandChoose: {},
+	CommandEnd: {}, CommandSetComplexAnimation: {}, CommandSetFilter: {}, CommandLabel: {},
+	CommandJumpLabel: {}, CommandSetVar: {}, CommandShowVars: {}, CommandUnlockCg: {},
+	CommandUnlockBgm: {}, CommandFilmMode: {}, CommandSetTextbox: {}, CommandSetAnimation: {},
+	CommandPlayEffect: {}, CommandSetTempAnimation: {}, CommandSetTransform: {},
+	CommandSetTransition: {}, CommandGetUserInput: {}, CommandApplyStyle: {}, CommandWait: {},
+	CommandCallSteam: {},
+}
+
+// isKnownCommand 判断是否为WebGAL内置命令
+func isKnownCommand(name string) bool {
+	_, ok := knownCommands[name]
+	return ok
+}
+
+// Arg 表示语句中的一个参数，例如 -id=soyo 或 -next
+type Arg struct {
+	Key      string // 参数名（不含前导'-'）
+	Value    string // 参数值，JSON值原样保留
+	HasValue bool   // 是否带有'='
+	Start    int    // 参数在原始行中的起始字节偏移（指向'-'）
+	End      int    // 参数在原始行中的结束字节偏移（不含）
+}
+
+// Statement 表示一条解析后的WebGAL语句
+type Statement struct {
+	Raw        string // 原始行
+	Command    string // 命令名，对话语句为 say，空行或纯注释行为空
+	Speaker    string // 说话人（仅对话语句）
+	HasSpeaker bool   // 是否显式写出了说话人（":文本" 为旁白，说话人为空但为true）
+	Content    string // 语句内容（已处理转义）
+	Args       []Arg  // 参数列表
+	Comment    string // 分号后的注释
+	Terminated bool   // 是否以分号结束
+
+	ContentStart int // 内容在原始行中的起始字节偏移
+	ContentEnd   int // 内容在原始行中的结束字节偏移（不含）
+	BodyEnd      int // 语句主体（分号或注释之前）的结束字节偏移
+}
+
+// ParseStatement 将一行WebGAL脚本解析为语句
+func ParseStatement(line string) *Statement {
+	stmt := &Statement{Raw: line}
+
+	bodyEnd, terminated := findStatementEnd(line)
+	stmt.BodyEnd = bodyEnd
+	stmt.Terminated = terminated
+	if terminated {
+		stmt.Comment = strings.TrimSpace(line[bodyEnd+1:])
+	}
+
+	body := line[:bodyEnd]
+	if strings.TrimSpace(body) == "" {
+		return stmt
+	}
+
+	argsStart := findArgsStart(body)
+	header := body[:argsStart]
+
+	// 跳过行首空白
+	headerStart := len(header) - len(strings.TrimLeft(header, " \t"))
+
+	// 查找命令/说话人与内容之间的冒号
+	contentStart := headerStart
+	if colon := indexUnescaped(header, ':', headerStart); colon >= 0 {
+		name := strings.TrimSpace(header[headerStart:colon])
+		if isKnownCommand(name) {
+			stmt.Command = name
+		} else {
+			stmt.Command = CommandSay
+			stmt.Speaker = unescape(name)
+			stmt.HasSpeaker = true
+		}
+		contentStart = colon + 1
+	} else if name := strings.TrimSpace(header[headerStart:]); isKnownCommand(name) {
+		// 没有冒号的内置命令（如 end;、showVars;），与WebGAL一致内容为空
+		stmt.Command = name
+		contentStart = argsStart
+	} else {
+		// 没有冒号的普通文本为续行对话，沿用上一位说话人
+		stmt.Command = CommandSay
+	}
+
+	// 去除内容两端空白，但记录准确的偏移
+	contentEnd := argsStart
+	for contentEnd > contentStart && isSpace(header[contentEnd-1]) {
+		contentEnd--
+	}
+	for contentStart < contentEnd && isSpace(header[contentStart]) {
+		contentStart++
+	}
+	stmt.ContentStart = contentStart
+	stmt.ContentEnd = contentEnd
+	stmt.Content = unescape(header[contentStart:contentEnd])
+
+	stmt.Args = parseArgs(body, argsStart)
+
+	// 显式的 say 命令通过 -speaker= 指定说话人（say:文本 -speaker=anon;）
+	if stmt.Command == CommandSay && !stmt.HasSpeaker {
+		if arg, ok := stmt.Arg("speaker"); ok {
+			stmt.Speaker = arg.Value
+			stmt.HasSpeaker = true
+		}
+	}
+	return stmt
+}
+
+// IsEmpty 判断是否为空行或纯注释行
+func (s *Statement) IsEmpty() bool {
+	return s.Command == ""
+}
+
+// IsSay 判断是否为对话语句
+func (s *Statement) IsSay() bool {
+	return s.Command == CommandSay
+}
+
+// Arg 按名称获取参数
+func (s *Statement) Arg(key string) (Arg, bool) {
+	for _, arg := range s.Args {
+		if arg.Key == key {
+			return arg, true
+		}
+	}
+	return Arg{}, false
+}
+
+// ArgValue 获取参数值，参数不存在时返回空字符串
+func (s *Statement) ArgValue(key string) string {
+	arg, _ := s.Arg(key)
+	return arg.Value
+}
+
+// HasArg 判断是否包含指定参数
+func (s *Statement) HasArg(key string) bool {
+	_, ok := s.Arg(key)
+	return ok
+}
+
+// findStatementEnd 查找语句结束的分号，忽略转义分号和JSON/引号内的分号
+func findStatementEnd(line string) (int, bool) {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i++
+		case inQuote:
+			if c == '"' {
+				inQuote = false
+			}
+		case c == '"' && depth > 0:
+			inQuote = true
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			return i, true
+		}
+	}
+	return len(line), false
+}
+
+// findArgsStart 查找参数区的起始位置，参数以 空白+'-'+字母 开头
+func findArgsStart(body string) int {
+	for i := 0; i+2 < len(body); i++ {
+		if body[i] == '\\' {
+			i++
+			continue
+		}
+		if isSpace(body[i]) && body[i+1] == '-' && isArgKeyStart(body[i+2]) {
+			return i
+		}
+	}
+	return len(body)
+}
+
+// parseArgs 解析参数区，支持带空格的JSON参数值
+func parseArgs(body string, start int) []Arg {
+	var args []Arg
+	i := start
+	for i < len(body) {
+		// 跳过空白
+		for i < len(body) && isSpace(body[i]) {
+			i++
+		}
+		if i >= len(body) {
+			break
+		}
+		if body[i] != '-' {
+			// 非参数内容，跳到下一个空白
+			for i < len(body) && !isSpace(body[i]) {
+				i++
+			}
+			continue
+		}
+
+		argStart := i
+		i++
+		keyStart := i
+		for i < len(body) && body[i] != '=' && !isSpace(body[i]) {
+			i++
+		}
+		arg := Arg{Key: body[keyStart:i], Start: argStart}
+
+		if i < len(body) && body[i] == '=' {
+			i++
+			arg.HasValue = true
+			valueStart := i
+			i = scanArgValue(body, i)
+			arg.Value = unescape(strings.TrimSpace(body[valueStart:i]))
+		}
+
+		// 去除参数末尾的空白
+		end := i
+		for end > argStart && isSpace(body[end-1]) {
+			end--
+		}
+		arg.End = end
+		args = append(args, arg)
+	}
+	return args
+}
+
+// scanArgValue 扫描参数值，直到遇到位于顶层的下一个参数
+func scanArgValue(body string, i int) int {
+	depth := 0
+	inQuote := false
+	for ; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			i++
+		case inQuote:
+			if c == '"' {
+				inQuote = false
+			}
+		case c == '"' && depth > 0:
+			inQuote = true
+		case c == '{' || c == '[':
+			depth++
+		case (c == '}' || c == ']') && depth > 0:
+			depth--
+		case depth == 0 && isSpace(c):
+			// 参数值中的空白仅在其后紧跟下一个参数时才结束该值
+			j := i
+			for j < len(body) && isSpace(body[j]) {
+				j++
+			}
+			if j >= len(body) || (body[j] == '-' && j+1 < len(body) && isArgKeyStart(body[j+1])) {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// indexUnescaped 从from开始查找未转义的字符
+func indexUnescaped(s string, target byte, from int) int {
+	for i := from; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape 处理 \; 和 \: 转义
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	r := strings.NewReplacer(`\;`, ";", `\:`, ":")
+	return r.Replace(s)
+}
+
+// isSpace 判断是否为空白字符
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// isArgKeyStart 判断是否可以作为参数名的首字符
+func isArgKeyStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
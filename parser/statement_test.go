@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		command    string
+		speaker    string
+		hasSpeaker bool
+		content    string
+		args       map[string]string
+		comment    string
+		terminated bool
+	}{
+		{
+			name:       "对话",
+			line:       "soyo:你好 -vocal=soyo_1.wav -next;",
+			command:    CommandSay,
+			speaker:    "soyo",
+			hasSpeaker: true,
+			content:    "你好",
+			args:       map[string]string{"vocal": "soyo_1.wav", "next": ""},
+			terminated: true,
+		},
+		{
+			name:       "旁白",
+			line:       ":雨停了;",
+			command:    CommandSay,
+			hasSpeaker: true,
+			content:    "雨停了",
+			terminated: true,
+		},
+		{
+			name:       "续行",
+			line:       "还没说完;",
+			command:    CommandSay,
+			content:    "还没说完",
+			terminated: true,
+		},
+		{
+			name:       "转义分号和冒号",
+			line:       `anon:时间是 12\:00\; 别迟到;`,
+			command:    CommandSay,
+			speaker:    "anon",
+			hasSpeaker: true,
+			content:    "时间是 12:00; 别迟到",
+			terminated: true,
+		},
+		{
+			name:       "说话人中的转义冒号",
+			line:       `a\:b:内容;`,
+			command:    CommandSay,
+			speaker:    "a:b",
+			hasSpeaker: true,
+			content:    "内容",
+			terminated: true,
+		},
+		{
+			name:       "注释",
+			line:       "changeBg:bg.png -next; 切换背景",
+			command:    CommandChangeBg,
+			content:    "bg.png",
+			args:       map[string]string{"next": ""},
+			comment:    "切换背景",
+			terminated: true,
+		},
+		{
+			name:       "纯注释行",
+			line:       "; 第一章",
+			comment:    "第一章",
+			terminated: true,
+		},
+		{
+			name: "空行",
+			line: "   ",
+		},
+		{
+			name:       "JSON参数值",
+			line:       `changeFigure:soyo.json -id=soyo -transform={"position": {"x": 100; "y": 0}} -next;`,
+			command:    CommandChangeFigure,
+			content:    "soyo.json",
+			args:       map[string]string{"id": "soyo", "transform": `{"position": {"x": 100; "y": 0}}`, "next": ""},
+			terminated: true,
+		},
+		{
+			name:       "JSON字符串中的分号和大括号",
+			line:       `setVar:a -value={"s": "};"};`,
+			command:    CommandSetVar,
+			content:    "a",
+			args:       map[string]string{"value": `{"s": "};"}`},
+			terminated: true,
+		},
+		{
+			name:       "没有冒号的内置命令",
+			line:       "end;",
+			command:    CommandEnd,
+			terminated: true,
+		},
+		{
+			name:       "没有冒号的内置命令带参数",
+			line:       "showVars -next;",
+			command:    CommandShowVars,
+			args:       map[string]string{"next": ""},
+			terminated: true,
+		},
+		{
+			name:       "未以分号结束",
+			line:       "soyo:还没写完",
+			command:    CommandSay,
+			speaker:    "soyo",
+			hasSpeaker: true,
+			content:    "还没写完",
+		},
+		{
+			name:       "行尾回车",
+			line:       "soyo:你好;\r",
+			command:    CommandSay,
+			speaker:    "soyo",
+			hasSpeaker: true,
+			content:    "你好",
+			terminated: true,
+		},
+		{
+			name:       "显式say命令的 -speaker=",
+			line:       "say:你好 -speaker=anon;",
+			command:    CommandSay,
+			speaker:    "anon",
+			hasSpeaker: true,
+			content:    "你好",
+			args:       map[string]string{"speaker": "anon"},
+			terminated: true,
+		},
+		{
+			name:       "显式say命令没有 -speaker= 时为续行",
+			line:       "say:你好;",
+			command:    CommandSay,
+			content:    "你好",
+			terminated: true,
+		},
+		{
+			name:       "内容中的连字符不是参数",
+			line:       "anon:A-B 和 -1;",
+			command:    CommandSay,
+			speaker:    "anon",
+			hasSpeaker: true,
+			content:    "A-B 和 -1",
+			terminated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := ParseStatement(tt.line)
+			if stmt.Command != tt.command {
+				t.Errorf("Command = %q, want %q", stmt.Command, tt.command)
+			}
+			if stmt.Speaker != tt.speaker || stmt.HasSpeaker != tt.hasSpeaker {
+				t.Errorf("Speaker = %q (%v), want %q (%v)", stmt.Speaker, stmt.HasSpeaker, tt.speaker, tt.hasSpeaker)
+			}
+			if stmt.Content != tt.content {
+				t.Errorf("Content = %q, want %q", stmt.Content, tt.content)
+			}
+			if stmt.Comment != tt.comment {
+				t.Errorf("Comment = %q, want %q", stmt.Comment, tt.comment)
+			}
+			if stmt.Terminated != tt.terminated {
+				t.Errorf("Terminated = %v, want %v", stmt.Terminated, tt.terminated)
+			}
+
+			args := make(map[string]string)
+			for _, arg := range stmt.Args {
+				args[arg.Key] = arg.Value
+			}
+			if tt.args == nil {
+				tt.args = map[string]string{}
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("Args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseStatementOffsets(t *testing.T) {
+	line := "soyo: 你好 -vocal=a.wav  -next; 注释"
+	stmt := ParseStatement(line)
+
+	if got := line[stmt.ContentStart:stmt.ContentEnd]; got != "你好" {
+		t.Errorf("内容偏移指向 %q", got)
+	}
+	for _, arg := range stmt.Args {
+		want := "-" + arg.Key
+		if arg.HasValue {
+			want += "=" + arg.Value
+		}
+		if got := line[arg.Start:arg.End]; got != want {
+			t.Errorf("参数偏移指向 %q, want %q", got, want)
+		}
+	}
+	if line[stmt.BodyEnd] != ';' {
+		t.Errorf("BodyEnd 指向 %q", line[stmt.BodyEnd])
+	}
+}
@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BackupSuffix 回写脚本前备份原文件使用的后缀
+const BackupSuffix = ".bak"
+
+// VocalChange 表示脚本中一行 -vocal= 的修改
+type VocalChange struct {
+	Step    int    // 与 ParseDialogue 的step一致，即从0开始的行号
+	OldLine string // 修改前的行
+	NewLine string // 修改后的行
+}
+
+// VocalRewriteOptions 回写 -vocal= 的选项
+type VocalRewriteOptions struct {
+	DryRun bool // 只计算修改，不写入文件
+	Backup bool // 写入前将原文件备份为 <文件名>.bak
+}
+
+// SetVocal 在一条对话语句上插入或更新 -vocal= 参数，保留其余参数、注释和格式
+func SetVocal(line, vocal string) (string, bool) {
+	stmt := ParseStatement(line)
+	if !stmt.IsSay() {
+		return line, false
+	}
+
+	newArg := "-vocal=" + vocal
+
+	// 已有 -vocal= 时原位替换
+	if arg, ok := stmt.Arg("vocal"); ok {
+		if arg.Value == vocal {
+			return line, false
+		}
+		return line[:arg.Start] + newArg + line[arg.End:], true
+	}
+
+	// 否则追加到最后一个参数之后，没有参数时追加到内容之后
+	insertAt := stmt.ContentEnd
+	if len(stmt.Args) > 0 {
+		insertAt = stmt.Args[len(stmt.Args)-1].End
+	}
+	return line[:insertAt] + " " + newArg + line[insertAt:], true
+}
+
+// RewriteVocals 按step→音频文件的映射回写脚本内容
+func RewriteVocals(content string, vocals map[int]string) (string, []VocalChange) {
+	lines := SplitScriptLines(content)
+
+	steps := make([]int, 0, len(vocals))
+	for step := range vocals {
+		steps = append(steps, step)
+	}
+	sort.Ints(steps)
+
+	var changes []VocalChange
+	for _, step := range steps {
+		if step < 0 || step >= len(lines) {
+			continue
+		}
+		newLine, changed := SetVocal(lines[step], vocals[step])
+		if !changed {
+			continue
+		}
+		changes = append(changes, VocalChange{Step: step, OldLine: lines[step], NewLine: newLine})
+		lines[step] = newLine
+	}
+
+	return strings.Join(lines, "\n"), changes
+}
+
+// WriteVocalsToFile 将 -vocal= 回写到脚本文件，DryRun时只返回修改列表
+func WriteVocalsToFile(path string, vocals map[int]string, opts VocalRewriteOptions) ([]VocalChange, error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取脚本文件失败: %v", err)
+	}
+
+	content, changes := RewriteVocals(string(original), vocals)
+	if opts.DryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	if opts.Backup {
+		if err := os.WriteFile(path+BackupSuffix, original, utils.FilePermission); err != nil {
+			return nil, fmt.Errorf("备份脚本文件失败: %v", err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(content), utils.FilePermission); err != nil {
+		return nil, fmt.Errorf("写入脚本文件失败: %v", err)
+	}
+
+	return changes, nil
+}
+
+// ScriptVocalChanges 一个脚本文件中 -vocal= 的修改
+type ScriptVocalChanges struct {
+	File    string
+	Changes []VocalChange
+}
+
+// VocalsFromPostDialogues 从已生成的语音构建 脚本文件→step→音频文件名 的映射
+// 同一流水线可能包含多个场景文件，step 只在各自文件内唯一，因此按 Source.File 分组；没有来源位置的对话被忽略
+func VocalsFromPostDialogues(posts []model.PostDialogue) map[string]map[int]string {
+	vocals := make(map[string]map[int]string)
+	for _, post := range posts {
+		if post.Status != model.PostDialogueDone || post.OutputPath == "" {
+			continue
+		}
+		if post.Source == nil || post.Source.File == "" {
+			continue
+		}
+		file := post.Source.File
+		if vocals[file] == nil {
+			vocals[file] = make(map[int]string)
+		}
+		vocals[file][post.Step] = filepath.Base(post.OutputPath)
+	}
+	return vocals
+}
+
+// WriteVocalsFromPostDialogues 将已生成的语音按所在脚本文件逐个回写 -vocal=，DryRun时只返回修改列表
+// 按文件名排序处理，某个文件失败时返回此前已处理的文件和错误
+func WriteVocalsFromPostDialogues(posts []model.PostDialogue, opts VocalRewriteOptions) ([]ScriptVocalChanges, error) {
+	vocals := VocalsFromPostDialogues(posts)
+	files := make([]string, 0, len(vocals))
+	for file := range vocals {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var all []ScriptVocalChanges
+	for _, file := range files {
+		changes, err := WriteVocalsToFile(file, vocals[file], opts)
+		if err != nil {
+			return all, fmt.Errorf("%s: %v", file, err)
+		}
+		if len(changes) > 0 {
+			all = append(all, ScriptVocalChanges{File: file, Changes: changes})
+		}
+	}
+	return all, nil
+}
+
+// MarkExistingOutputs 将输出音频已存在的对话标记为生成完成，返回标记的数量
+// 用于为之前生成的语音回写 -vocal=，不需要重新生成
+func MarkExistingOutputs(posts []model.PostDialogue) int {
+	marked := 0
+	for i := range posts {
+		if posts[i].OutputPath == "" {
+			continue
+		}
+		if _, err := os.Stat(posts[i].OutputPath); err != nil {
+			continue
+		}
+		posts[i].Status = model.PostDialogueDone
+		marked++
+	}
+	return marked
+}
+
+// FormatVocalDiff 将修改列表格式化为便于预览的差异文本，行号从1开始
+func FormatVocalDiff(changes []VocalChange) string {
+	var sb strings.Builder
+	for _, change := range changes {
+		fmt.Fprintf(&sb, "@@ 第%d行 @@\n", change.Step+1)
+		fmt.Fprintf(&sb, "-%s\n", strings.TrimRight(change.OldLine, "\r"))
+		fmt.Fprintf(&sb, "+%s\n", strings.TrimRight(change.NewLine, "\r"))
+	}
+	return sb.String()
+}
+
+// FormatScriptVocalDiff 按文件格式化多个脚本的修改
+func FormatScriptVocalDiff(all []ScriptVocalChanges) string {
+	var sb strings.Builder
+	for _, script := range all {
+		fmt.Fprintf(&sb, "=== %s ===\n", script.File)
+		sb.WriteString(FormatVocalDiff(script.Changes))
+	}
+	return sb.String()
+}
+
+// CountVocalChanges 返回修改的总行数
+func CountVocalChanges(all []ScriptVocalChanges) int {
+	count := 0
+	for _, script := range all {
+		count += len(script.Changes)
+	}
+	return count
+}
@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSetVocal(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		vocal   string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "没有参数时追加到内容之后",
+			line:    "soyo:你好;",
+			vocal:   "soyo_1.wav",
+			want:    "soyo:你好 -vocal=soyo_1.wav;",
+			changed: true,
+		},
+		{
+			name:    "追加到最后一个参数之后",
+			line:    "soyo:你好 -next -fontSize=large;",
+			vocal:   "soyo_1.wav",
+			want:    "soyo:你好 -next -fontSize=large -vocal=soyo_1.wav;",
+			changed: true,
+		},
+		{
+			name:    "原位替换已有的 -vocal=",
+			line:    "soyo:你好 -vocal=old.wav -next;",
+			vocal:   "soyo_1.wav",
+			want:    "soyo:你好 -vocal=soyo_1.wav -next;",
+			changed: true,
+		},
+		{
+			name:  "值相同时不修改",
+			line:  "soyo:你好 -vocal=soyo_1.wav;",
+			vocal: "soyo_1.wav",
+			want:  "soyo:你好 -vocal=soyo_1.wav;",
+		},
+		{
+			name:    "保留注释",
+			line:    "soyo:你好; 开场白",
+			vocal:   "soyo_1.wav",
+			want:    "soyo:你好 -vocal=soyo_1.wav; 开场白",
+			changed: true,
+		},
+		{
+			name:    "保留转义",
+			line:    `soyo:12\:00\; 见;`,
+			vocal:   "soyo_1.wav",
+			want:    `soyo:12\:00\; 见 -vocal=soyo_1.wav;`,
+			changed: true,
+		},
+		{
+			name:    "保留行尾回车",
+			line:    "soyo:你好;\r",
+			vocal:   "soyo_1.wav",
+			want:    "soyo:你好 -vocal=soyo_1.wav;\r",
+			changed: true,
+		},
+		{
+			name:    "未以分号结束的行尾回车",
+			line:    "soyo:你好\r",
+			vocal:   "soyo_1.wav",
+			want:    "soyo:你好 -vocal=soyo_1.wav\r",
+			changed: true,
+		},
+		{
+			name:    "续行",
+			line:    "还没说完;",
+			vocal:   "soyo_2.wav",
+			want:    "还没说完 -vocal=soyo_2.wav;",
+			changed: true,
+		},
+		{
+			name:  "非对话语句不修改",
+			line:  "changeFigure:soyo.json -next;",
+			vocal: "soyo_1.wav",
+			want:  "changeFigure:soyo.json -next;",
+		},
+		{
+			name:  "没有冒号的内置命令不修改",
+			line:  "end;",
+			vocal: "soyo_1.wav",
+			want:  "end;",
+		},
+		{
+			name:  "纯注释行不修改",
+			line:  "; soyo:你好;",
+			vocal: "soyo_1.wav",
+			want:  "; soyo:你好;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := SetVocal(tt.line, tt.vocal)
+			if got != tt.want || changed != tt.changed {
+				t.Errorf("SetVocal(%q) = %q, %v, want %q, %v", tt.line, got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
+
+func TestRewriteVocals(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		vocals  map[int]string
+		want    string
+		steps   []int
+	}{
+		{
+			name:    "按行号回写",
+			content: "changeBg:bg.png;\nsoyo:你好;\nanon:嗯;\n",
+			vocals:  map[int]string{1: "soyo_1.wav", 2: "anon_2.wav"},
+			want:    "changeBg:bg.png;\nsoyo:你好 -vocal=soyo_1.wav;\nanon:嗯 -vocal=anon_2.wav;\n",
+			steps:   []int{1, 2},
+		},
+		{
+			name:    "保留CRLF换行",
+			content: "soyo:你好;\r\nanon:嗯;\r\n",
+			vocals:  map[int]string{0: "soyo_0.wav", 1: "anon_1.wav"},
+			want:    "soyo:你好 -vocal=soyo_0.wav;\r\nanon:嗯 -vocal=anon_1.wav;\r\n",
+			steps:   []int{0, 1},
+		},
+		{
+			name:    "跳过非对话行和越界行号",
+			content: "changeBg:bg.png;\nsoyo:你好;",
+			vocals:  map[int]string{0: "x.wav", 1: "soyo_1.wav", 5: "y.wav", -1: "z.wav"},
+			want:    "changeBg:bg.png;\nsoyo:你好 -vocal=soyo_1.wav;",
+			steps:   []int{1},
+		},
+		{
+			name:    "没有修改",
+			content: "soyo:你好 -vocal=soyo_0.wav;",
+			vocals:  map[int]string{0: "soyo_0.wav"},
+			want:    "soyo:你好 -vocal=soyo_0.wav;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := RewriteVocals(tt.content, tt.vocals)
+			if got != tt.want {
+				t.Errorf("RewriteVocals() = %q, want %q", got, tt.want)
+			}
+			var steps []int
+			for _, change := range changes {
+				steps = append(steps, change.Step)
+			}
+			if !reflect.DeepEqual(steps, tt.steps) {
+				t.Errorf("修改的行 = %v, want %v", steps, tt.steps)
+			}
+		})
+	}
+}
+
+func TestWriteVocalsToFile(t *testing.T) {
+	original := "soyo:你好;\r\nanon:嗯;\r\n"
+	vocals := map[int]string{0: "soyo_0.wav"}
+	want := "soyo:你好 -vocal=soyo_0.wav;\r\nanon:嗯;\r\n"
+
+	path := filepath.Join(t.TempDir(), "start.txt")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// DryRun 不写入文件
+	changes, err := WriteVocalsToFile(path, vocals, VocalRewriteOptions{DryRun: true})
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("DryRun: changes = %v, err = %v", changes, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("DryRun 修改了文件: %q", data)
+	}
+
+	if _, err := WriteVocalsToFile(path, vocals, VocalRewriteOptions{Backup: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("回写后的脚本 = %q, want %q", data, want)
+	}
+	if data, _ := os.ReadFile(path + BackupSuffix); string(data) != original {
+		t.Errorf("备份文件 = %q, want %q", data, original)
+	}
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"myvoicego/api"
+	"myvoicego/model"
+	"myvoicego/parser"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Stage 流水线阶段
+type Stage string
+
+const (
+	StageParse      Stage = "parse"      // 解析脚本
+	StageAnalyze    Stage = "analyze"    // 语气分析
+	StageReceive    Stage = "receive"    // 接收语气分析的流式响应
+	StageBuild      Stage = "build"      // 匹配参考音频
+	StageSynthesize Stage = "synthesize" // 语音合成
+)
+
+// ProgressFunc 进度回调，done/total 为当前阶段已完成和总的对话数
+// StageReceive 阶段 done 为已接收的字符数，total 固定为0
+type ProgressFunc func(stage Stage, done, total int)
+
+// Pipeline 从脚本到语音文件的完整流程：解析 → 语气分析 → 匹配参考音频 → 语音合成
+// 所有阶段共用调用方传入的 ctx，取消后正在进行的 HTTP 请求会立即中断
+type Pipeline struct {
+	Analyzer  api.ToneAnalyzer
+	TTS       *api.GPTSvotisAPI
+	Builder   *parser.PostDialogueBuilder
+	Registry  *utils.CharacterRegistry // 可为空
+	Models    ModelResolver            // 对话使用的模型权重，为空时不切换模型
+	Variables map[string]string        // 文本中 {var} 朗读时的替换值，可为空
+	Progress  ProgressFunc             // 可为空
+	OutputDir string                   // 语音和清单的输出目录
+
+	loaded   *utils.CharacterModel // GPT-SoVITS 当前已加载的模型
+	received int                   // 本次语气分析已接收的流式响应字符数
+}
+
+// NewPipeline 创建流水线
+func NewPipeline(analyzer api.ToneAnalyzer, tts *api.GPTSvotisAPI, refs []utils.AudioRefModel, outputDir string) *Pipeline {
+	return &Pipeline{
+		Analyzer:  analyzer,
+		TTS:       tts,
+		Builder:   parser.NewPostDialogueBuilder(refs, outputDir),
+		OutputDir: outputDir,
+	}
+}
+
+// Result 流水线的运行结果，取消或出错时包含已完成部分
+type Result struct {
+	Dialogues   []model.PostDialogue
+	Diagnostics []parser.Diagnostic
+}
+
+// Summary 返回各生成状态的对话数量
+func (r *Result) Summary() string {
+	counts := make(map[model.PostDialogueStatus]int)
+	for _, post := range r.Dialogues {
+		counts[post.Status]++
+	}
+	return fmt.Sprintf("完成 %d 条，失败 %d 条，跳过 %d 条，未处理 %d 条",
+		counts[model.PostDialogueDone], counts[model.PostDialogueFailed],
+		counts[model.PostDialogueSkipped], counts[model.PostDialoguePending])
+}
+
+// Failed 返回生成失败的对话数
+func (r *Result) Failed() int {
+	failed := 0
+	for _, post := range r.Dialogues {
+		if post.Status == model.PostDialogueFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Run 处理单个脚本文件，或包含 scene/start.txt 的WebGAL游戏目录
+// 游戏目录按场景跳转加载所有可达场景，逐个场景分析语气，对话的 Source.File 记录所在的场景文件
+func (p *Pipeline) Run(ctx context.Context, path string) (*Result, error) {
+	result := &Result{}
+
+	p.report(StageParse, 0, 1)
+	scenes, diagnostics, err := p.parse(path)
+	if err != nil {
+		return result, err
+	}
+	result.Diagnostics = diagnostics
+	total := 0
+	for _, scene := range scenes {
+		total += len(scene.Dialogues)
+	}
+	p.report(StageParse, 1, 1)
+	if total == 0 {
+		return result, fmt.Errorf("脚本中没有对话: %s", path)
+	}
+
+	// 逐个场景分析，语气分析的上下文不跨越场景
+	p.received = 0
+	p.report(StageAnalyze, 0, total)
+	analyzed := make([]model.PreDialogue, 0, total)
+	for _, scene := range scenes {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if len(scene.Dialogues) == 0 {
+			continue
+		}
+		sceneAnalyzed, err := p.Analyzer.Analyze(ctx, scene.Dialogues)
+		if err != nil {
+			return result, fmt.Errorf("场景 %s 语气分析失败: %w", scene.Name, err)
+		}
+		analyzed = append(analyzed, sceneAnalyzed...)
+		p.report(StageAnalyze, len(analyzed), total)
+	}
+
+	result.Dialogues = p.Builder.Build(analyzed)
+	p.report(StageBuild, len(result.Dialogues), len(result.Dialogues))
+
+	err = p.Synthesize(ctx, result.Dialogues)
+
+	// 取消时也写出清单，记录已完成和未处理的对话
+	manifest := filepath.Join(p.OutputDir, ManifestName)
+	if writeErr := WriteManifest(manifest, result.Dialogues); writeErr != nil && err == nil {
+		err = writeErr
+	}
+	return result, err
+}
+
+// parse 解析脚本文件或游戏目录，单个脚本视为只有一个场景
+func (p *Pipeline) parse(path string) ([]parser.SceneResult, []parser.Diagnostic, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取脚本失败: %v", err)
+	}
+
+	if info.IsDir() {
+		project, err := parser.LoadProject(path, p.Registry, p.Variables)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, scene := range project.Unreachable {
+			fmt.Printf("场景 %s 无法从入口场景到达，不生成语音\n", scene)
+		}
+		return project.Scenes, project.AllDiagnostics(), nil
+	}
+
+	dp := parser.NewDialogueParser()
+	dp.SetCharacterRegistry(p.Registry)
+	dp.SetVariables(p.Variables)
+	if err := dp.ParseFile(path); err != nil {
+		return nil, nil, err
+	}
+	scene := parser.SceneResult{
+		Name:        filepath.Base(path),
+		Path:        path,
+		Dialogues:   dp.Dialogues(),
+		Diagnostics: dp.Diagnostics(),
+	}
+	return []parser.SceneResult{scene}, scene.Diagnostics, nil
+}
+
+// Synthesize 合成等待生成的对话，结果写入各自的 OutputPath 并更新状态
+// 对话按模型分组，每组只切换一次模型，posts 本身保持脚本顺序
+// ctx 取消时中断当前请求并返回 ctx.Err()，未处理的对话保持等待状态
+func (p *Pipeline) Synthesize(ctx context.Context, posts []model.PostDialogue) error {
+	groups := groupByModel(posts, p.Models)
+	total := 0
+	for _, group := range groups {
+		total += len(group.indices)
+	}
+
+	done := 0
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if group.hasWeights {
+			if err := p.loadWeights(ctx, group.weights); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				fmt.Printf("%v，跳过使用该模型的 %d 条对话\n", err, len(group.indices))
+				markFailed(posts, group.indices, err)
+				done += len(group.indices)
+				continue
+			}
+		}
+
+		for _, i := range group.indices {
+			p.report(StageSynthesize, done, total)
+			if err := p.synthesizeOne(ctx, &posts[i]); err != nil {
+				if ctx.Err() != nil {
+					// 被取消的对话仍视为等待生成
+					return ctx.Err()
+				}
+				posts[i].Status = model.PostDialogueFailed
+				posts[i].Error = err.Error()
+				fmt.Printf("第 %d 行语音生成失败: %v\n", posts[i].Step+1, err)
+			} else {
+				posts[i].Status = model.PostDialogueDone
+				posts[i].Error = ""
+			}
+			done++
+		}
+	}
+	p.report(StageSynthesize, total, total)
+	return nil
+}
+
+// synthesizeOne 合成单条对话并写入文件，音频直接写入磁盘，不受响应大小限制
+func (p *Pipeline) synthesizeOne(ctx context.Context, post *model.PostDialogue) error {
+	_, err := p.TTS.SaveTTS(ctx, post.TTS, post.OutputPath)
+	return err
+}
+
+// StreamProgress 返回语气分析流式响应的进度回调，用于设置 ToneAnalyzerConfig.Progress
+// 各分段收到的内容累加后以 StageReceive 阶段报告；CozeAPI 保证回调串行执行
+func (p *Pipeline) StreamProgress() api.StreamProgressFunc {
+	return func(delta string, _ int) {
+		p.received += utf8.RuneCountInString(delta)
+		p.report(StageReceive, p.received, 0)
+	}
+}
+
+// report 调用进度回调
+func (p *Pipeline) report(stage Stage, done, total int) {
+	if p.Progress != nil {
+		p.Progress(stage, done, total)
+	}
+}
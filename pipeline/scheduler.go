@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myvoicego/model"
+	"myvoicego/utils"
+	"os"
+	"path/filepath"
+)
+
+// ManifestName 输出目录中清单文件的名称
+const ManifestName = "manifest.json"
+
+// ModelResolver 返回对话应使用的模型权重，ok 为 false 时沿用当前已加载的模型
+type ModelResolver func(post model.PostDialogue) (weights utils.CharacterModel, ok bool)
+
+// RegistryModelResolver 按角色表查找模型，由行内 -voiceModel、AudioId 和语气选择角色的模型变体
+func RegistryModelResolver(registry *utils.CharacterRegistry) ModelResolver {
+	return func(post model.PostDialogue) (utils.CharacterModel, bool) {
+		tone := post.ResolvedTone
+		if tone == "" {
+			tone = post.Tone
+		}
+		for _, key := range []string{post.Id, post.Name} {
+			if c, ok := registry.Lookup(key); ok {
+				return c.SelectModel(post.AudioId, tone, post.ModelVariant)
+			}
+		}
+		return utils.CharacterModel{}, false
+	}
+}
+
+// synthesisGroup 使用同一组模型权重的对话
+type synthesisGroup struct {
+	weights    utils.CharacterModel
+	hasWeights bool
+	indices    []int // 对话在原列表中的下标，保持脚本顺序
+}
+
+// groupByModel 将等待生成的对话按模型分组，组按首次出现的顺序排列
+// 没有对应模型的对话排在最前，使用当前已加载的模型
+func groupByModel(posts []model.PostDialogue, resolve ModelResolver) []synthesisGroup {
+	unassigned := synthesisGroup{}
+	var groups []synthesisGroup
+	index := make(map[weightsKey]int)
+
+	for i, post := range posts {
+		if post.Status != model.PostDialoguePending {
+			continue
+		}
+		var weights utils.CharacterModel
+		ok := false
+		if resolve != nil {
+			weights, ok = resolve(post)
+		}
+		if !ok {
+			unassigned.indices = append(unassigned.indices, i)
+			continue
+		}
+		g, exists := index[keyOf(weights)]
+		if !exists {
+			g = len(groups)
+			index[keyOf(weights)] = g
+			groups = append(groups, synthesisGroup{weights: weights, hasWeights: true})
+		}
+		groups[g].indices = append(groups[g].indices, i)
+	}
+
+	if len(unassigned.indices) > 0 {
+		groups = append([]synthesisGroup{unassigned}, groups...)
+	}
+	return groups
+}
+
+// weightsKey 按实际加载的权重文件区分模型，名称等选择条件不影响分组
+type weightsKey struct {
+	gpt, sovits string
+}
+
+// keyOf 返回模型的权重文件
+func keyOf(weights utils.CharacterModel) weightsKey {
+	return weightsKey{gpt: weights.GPTWeights, sovits: weights.SoVITSWeights}
+}
+
+// loadWeights 切换 GPT-SoVITS 的模型权重，已加载时跳过
+func (p *Pipeline) loadWeights(ctx context.Context, weights utils.CharacterModel) error {
+	if p.loaded != nil && keyOf(*p.loaded) == keyOf(weights) {
+		return nil
+	}
+
+	fmt.Printf("切换模型: %s, %s\n", weights.GPTWeights, weights.SoVITSWeights)
+	// 切换中途失败时已加载的模型不确定
+	p.loaded = nil
+	if weights.GPTWeights != "" {
+		if _, err := p.TTS.SetGPTWeights(ctx, weights.GPTWeights); err != nil {
+			return fmt.Errorf("切换GPT模型失败: %w", err)
+		}
+	}
+	if weights.SoVITSWeights != "" {
+		if _, err := p.TTS.SetSoVITSWeights(ctx, weights.SoVITSWeights); err != nil {
+			return fmt.Errorf("切换SoVITS模型失败: %w", err)
+		}
+	}
+	p.loaded = &weights
+	return nil
+}
+
+// markFailed 将一组对话标记为失败
+func markFailed(posts []model.PostDialogue, indices []int, err error) {
+	for _, i := range indices {
+		posts[i].Status = model.PostDialogueFailed
+		posts[i].Error = err.Error()
+	}
+}
+
+// WriteManifest 将对话按脚本顺序写入清单文件
+func WriteManifest(path string, posts []model.PostDialogue) error {
+	data, err := json.MarshalIndent(posts, "", "    ")
+	if err != nil {
+		return fmt.Errorf("序列化清单失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), utils.DirPermission); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, utils.FilePermission); err != nil {
+		return fmt.Errorf("写入清单失败: %w", err)
+	}
+	return nil
+}
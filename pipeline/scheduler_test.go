@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"myvoicego/model"
+	"myvoicego/utils"
+	"reflect"
+	"testing"
+)
+
+func TestGroupByModel(t *testing.T) {
+	soyo := utils.CharacterModel{Name: "soyo", GPTWeights: "soyo.ckpt", SoVITSWeights: "soyo.pth"}
+	// 名称不同但权重文件相同，使用同一组
+	soyoAlias := utils.CharacterModel{Name: "soyo-yami", GPTWeights: "soyo.ckpt", SoVITSWeights: "soyo.pth"}
+	anon := utils.CharacterModel{GPTWeights: "anon.ckpt", SoVITSWeights: "anon.pth"}
+	models := map[string]utils.CharacterModel{"soyo": soyo, "soyo-yami": soyoAlias, "anon": anon}
+	resolve := func(post model.PostDialogue) (utils.CharacterModel, bool) {
+		weights, ok := models[post.Id]
+		return weights, ok
+	}
+
+	post := func(id string, status model.PostDialogueStatus) model.PostDialogue {
+		return model.PostDialogue{PreDialogue: model.PreDialogue{Id: id}, Status: status}
+	}
+
+	tests := []struct {
+		name    string
+		posts   []model.PostDialogue
+		resolve ModelResolver
+		want    [][]int // 每组对话的下标
+		weights []bool  // 每组是否有模型
+	}{
+		{
+			name: "按首次出现的顺序分组并保持脚本顺序",
+			posts: []model.PostDialogue{
+				post("anon", model.PostDialoguePending),
+				post("soyo", model.PostDialoguePending),
+				post("anon", model.PostDialoguePending),
+				post("soyo-yami", model.PostDialoguePending),
+			},
+			resolve: resolve,
+			want:    [][]int{{0, 2}, {1, 3}},
+			weights: []bool{true, true},
+		},
+		{
+			name: "没有模型的对话排在最前",
+			posts: []model.PostDialogue{
+				post("soyo", model.PostDialoguePending),
+				post("taki", model.PostDialoguePending),
+				post("anon", model.PostDialoguePending),
+			},
+			resolve: resolve,
+			want:    [][]int{{1}, {0}, {2}},
+			weights: []bool{false, true, true},
+		},
+		{
+			name: "跳过不需要生成的对话",
+			posts: []model.PostDialogue{
+				post("soyo", model.PostDialogueSkipped),
+				post("soyo", model.PostDialogueDone),
+				post("anon", model.PostDialoguePending),
+			},
+			resolve: resolve,
+			want:    [][]int{{2}},
+			weights: []bool{true},
+		},
+		{
+			name: "没有模型解析器时全部使用当前模型",
+			posts: []model.PostDialogue{
+				post("soyo", model.PostDialoguePending),
+				post("anon", model.PostDialoguePending),
+			},
+			want:    [][]int{{0, 1}},
+			weights: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]int
+			var weights []bool
+			for _, group := range groupByModel(tt.posts, tt.resolve) {
+				got = append(got, group.indices)
+				weights = append(weights, group.hasWeights)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(weights, tt.weights) {
+				t.Errorf("分组 = %v %v, want %v %v", got, weights, tt.want, tt.weights)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package views
+
+import (
+	"fmt"
+	"io"
+	"myvoicego/parser"
+	"myvoicego/utils"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// DiagnosticsView 脚本检查页面，列出解析脚本时产生的诊断信息
+type DiagnosticsView struct {
+	window      fyne.Window
+	diagnostics []parser.Diagnostic
+	list        *widget.List
+	status      *widget.Label
+}
+
+// NewDiagnosticsView 创建脚本检查页面
+func NewDiagnosticsView(window fyne.Window) *DiagnosticsView {
+	v := &DiagnosticsView{
+		window: window,
+		status: widget.NewLabel("请选择要检查的WebGAL脚本"),
+	}
+
+	v.list = widget.NewList(
+		func() int {
+			return len(v.diagnostics)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(v.diagnostics[id].String())
+		},
+	)
+
+	return v
+}
+
+// Content 返回页面内容
+func (v *DiagnosticsView) Content() fyne.CanvasObject {
+	openButton := widget.NewButton("打开脚本", v.openScript)
+
+	return container.NewBorder(
+		container.NewHBox(openButton, v.status), // 顶部
+		nil,                                     // 底部
+		nil,                                     // 左侧
+		nil,                                     // 右侧
+		v.list,                                  // 中心内容
+	)
+}
+
+// SetDiagnostics 更新诊断列表
+func (v *DiagnosticsView) SetDiagnostics(diagnostics []parser.Diagnostic) {
+	v.diagnostics = diagnostics
+	v.list.Refresh()
+}
+
+// openScript 选择并检查脚本
+func (v *DiagnosticsView) openScript() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("读取脚本失败: %v", err), v.window)
+			return
+		}
+
+		p := parser.NewDialogueParser()
+		if registry, err := utils.LoadCharacterRegistry(utils.DefaultModelPathConfig); err == nil {
+			p.SetCharacterRegistry(registry)
+		}
+		variables, err := parser.LoadVariables(parser.DefaultVariablesConfig)
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		p.SetVariables(variables)
+		p.SetFile(reader.URI().Name())
+		p.ParseScript(string(content))
+
+		v.SetDiagnostics(p.Diagnostics())
+		v.status.SetText(fmt.Sprintf("%s：共 %d 条对话，%d 条诊断信息",
+			reader.URI().Name(), len(p.Dialogues()), len(p.Diagnostics())))
+	}, v.window)
+}
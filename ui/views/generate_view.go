@@ -0,0 +1,257 @@
+package views
+
+import (
+	"context"
+	"fmt"
+	"myvoicego/api"
+	"myvoicego/parser"
+	"myvoicego/pipeline"
+	"myvoicego/utils"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 语音生成页面的默认目录
+const (
+	DefaultReferenceDir = "reference"
+	DefaultOutputDir    = "output"
+)
+
+// GenerateView 语音生成页面，运行完整流水线，可随时取消
+type GenerateView struct {
+	window       fyne.Window
+	scriptEntry  *widget.Entry
+	refEntry     *widget.Entry
+	outputEntry  *widget.Entry
+	varsEntry    *widget.Entry
+	startButton  *widget.Button
+	cancelButton *widget.Button
+	vocalButton  *widget.Button
+	progress     *widget.ProgressBar
+	status       *widget.Label
+	cancel       context.CancelFunc // 正在运行时不为空
+	result       *pipeline.Result   // 最近一次运行的结果，用于回写 -vocal=
+}
+
+// NewGenerateView 创建语音生成页面
+func NewGenerateView(window fyne.Window) *GenerateView {
+	v := &GenerateView{
+		window:      window,
+		scriptEntry: widget.NewEntry(),
+		refEntry:    widget.NewEntry(),
+		outputEntry: widget.NewEntry(),
+		varsEntry:   widget.NewEntry(),
+		progress:    widget.NewProgressBar(),
+		status:      widget.NewLabel("请选择要生成语音的WebGAL脚本或游戏目录"),
+	}
+	v.scriptEntry.SetPlaceHolder("脚本或游戏目录路径")
+	v.refEntry.SetText(DefaultReferenceDir)
+	v.outputEntry.SetText(DefaultOutputDir)
+	v.varsEntry.SetText(parser.DefaultVariablesConfig)
+
+	v.startButton = widget.NewButton("开始生成", v.start)
+	v.cancelButton = widget.NewButton("取消", v.stop)
+	v.cancelButton.Disable()
+	v.vocalButton = widget.NewButton("回写 -vocal=", v.writeVocals)
+	v.vocalButton.Disable()
+
+	return v
+}
+
+// Content 返回页面内容
+func (v *GenerateView) Content() fyne.CanvasObject {
+	openButton := widget.NewButton("选择脚本", v.chooseScript)
+	folderButton := widget.NewButton("选择游戏目录", v.chooseGameDir)
+
+	form := widget.NewForm(
+		widget.NewFormItem("脚本", container.NewBorder(nil, nil, nil, container.NewHBox(openButton, folderButton), v.scriptEntry)),
+		widget.NewFormItem("参考音频目录", v.refEntry),
+		widget.NewFormItem("输出目录", v.outputEntry),
+		widget.NewFormItem("变量文件", v.varsEntry),
+	)
+
+	return container.NewVBox(
+		form,
+		container.NewHBox(v.startButton, v.cancelButton, v.vocalButton),
+		v.progress,
+		v.status,
+	)
+}
+
+// chooseScript 选择脚本文件
+func (v *GenerateView) chooseScript() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+		v.scriptEntry.SetText(reader.URI().Path())
+	}, v.window)
+}
+
+// chooseGameDir 选择包含 scene/start.txt 的游戏目录，生成所有可达场景的语音
+func (v *GenerateView) chooseGameDir() {
+	dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		if dir == nil {
+			return
+		}
+		v.scriptEntry.SetText(dir.Path())
+	}, v.window)
+}
+
+// start 在后台运行流水线
+func (v *GenerateView) start() {
+	scriptPath := v.scriptEntry.Text
+	if scriptPath == "" {
+		dialog.ShowError(fmt.Errorf("请先选择脚本或游戏目录"), v.window)
+		return
+	}
+
+	refs, err := utils.BuildReferenceAudioList(v.refEntry.Text)
+	if err != nil {
+		dialog.ShowError(err, v.window)
+		return
+	}
+	analyzerConfig, err := api.LoadToneAnalyzerConfig(api.DefaultToneAnalyzerConfig)
+	if err != nil {
+		dialog.ShowError(err, v.window)
+		return
+	}
+
+	tts, err := api.NewGPTSvotisAPIFromConfig(utils.DefaultGSVConfig)
+	if err != nil {
+		dialog.ShowError(err, v.window)
+		return
+	}
+
+	p := pipeline.NewPipeline(nil, tts, refs, v.outputEntry.Text)
+	analyzerConfig.Progress = p.StreamProgress()
+	if p.Analyzer, err = api.NewToneAnalyzer(analyzerConfig, refs); err != nil {
+		dialog.ShowError(err, v.window)
+		return
+	}
+	p.Registry, _ = utils.LoadCharacterRegistry(utils.DefaultModelPathConfig)
+	p.Models = pipeline.RegistryModelResolver(p.Registry)
+	if p.Variables, err = parser.LoadVariables(v.varsEntry.Text); err != nil {
+		dialog.ShowError(err, v.window)
+		return
+	}
+	p.Progress = func(stage pipeline.Stage, done, total int) {
+		fyne.Do(func() { v.showProgress(stage, done, total) })
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancel = cancel
+	v.setRunning(true)
+
+	go func() {
+		result, err := p.Run(ctx, scriptPath)
+		canceled := ctx.Err() != nil
+		cancel()
+		fyne.Do(func() {
+			v.cancel = nil
+			v.result = result
+			v.setRunning(false)
+			v.showResult(result, err, canceled)
+		})
+	}()
+}
+
+// stop 取消正在运行的流水线，进行中的请求会立即中断
+func (v *GenerateView) stop() {
+	if v.cancel != nil {
+		v.cancel()
+		v.status.SetText("正在取消...")
+	}
+}
+
+// setRunning 切换按钮状态
+func (v *GenerateView) setRunning(running bool) {
+	if running {
+		v.startButton.Disable()
+		v.cancelButton.Enable()
+		v.vocalButton.Disable()
+		v.progress.SetValue(0)
+		return
+	}
+	v.startButton.Enable()
+	v.cancelButton.Disable()
+	if v.result != nil && len(parser.VocalsFromPostDialogues(v.result.Dialogues)) > 0 {
+		v.vocalButton.Enable()
+	}
+}
+
+// writeVocals 预览 -vocal= 的修改，确认后回写到脚本，原文件备份为 .bak
+func (v *GenerateView) writeVocals() {
+	if v.result == nil {
+		return
+	}
+	preview, err := parser.WriteVocalsFromPostDialogues(v.result.Dialogues, parser.VocalRewriteOptions{DryRun: true})
+	if err != nil {
+		dialog.ShowError(err, v.window)
+		return
+	}
+	if len(preview) == 0 {
+		dialog.ShowInformation("回写 -vocal=", "脚本中的 -vocal= 已是最新", v.window)
+		return
+	}
+
+	diff := widget.NewLabel(parser.FormatScriptVocalDiff(preview))
+	scroll := container.NewScroll(diff)
+	scroll.SetMinSize(fyne.NewSize(600, 400))
+	title := fmt.Sprintf("将修改 %d 个脚本中的 %d 行", len(preview), parser.CountVocalChanges(preview))
+	dialog.ShowCustomConfirm(title, "回写", "取消", scroll, func(ok bool) {
+		if !ok {
+			return
+		}
+		written, err := parser.WriteVocalsFromPostDialogues(v.result.Dialogues, parser.VocalRewriteOptions{Backup: true})
+		if err != nil {
+			dialog.ShowError(err, v.window)
+			return
+		}
+		v.status.SetText(fmt.Sprintf("已回写 %d 个脚本中的 %d 行 -vocal=", len(written), parser.CountVocalChanges(written)))
+	}, v.window)
+}
+
+// showProgress 显示当前阶段和进度
+func (v *GenerateView) showProgress(stage pipeline.Stage, done, total int) {
+	switch stage {
+	case pipeline.StageParse:
+		v.status.SetText("正在解析脚本...")
+	case pipeline.StageAnalyze:
+		v.status.SetText(fmt.Sprintf("正在分析 %d 条对话的语气...", total))
+	case pipeline.StageReceive:
+		v.status.SetText(fmt.Sprintf("正在分析语气，已接收 %d 字...", done))
+	case pipeline.StageSynthesize:
+		v.status.SetText(fmt.Sprintf("正在生成语音 %d/%d", done, total))
+		if total > 0 {
+			v.progress.SetValue(float64(done) / float64(total))
+		}
+	}
+}
+
+// showResult 显示运行结果
+func (v *GenerateView) showResult(result *pipeline.Result, err error, canceled bool) {
+	summary := result.Summary()
+
+	switch {
+	case err != nil && canceled:
+		v.status.SetText("已取消：" + summary)
+	case err != nil:
+		v.status.SetText(summary)
+		dialog.ShowError(err, v.window)
+	default:
+		v.status.SetText(summary)
+	}
+}
@@ -33,20 +33,20 @@ func NewMainView() *MainView {
 
 // createUI 创建UI界面
 func (v *MainView) createUI() {
-	// 创建三个简单的页面，每个页面只显示"Hello"
-	page1 := widget.NewLabel("Hello - Page 1")
-	page1.Alignment = fyne.TextAlignCenter
+	// 脚本检查页面
+	page1 := NewDiagnosticsView(v.window).Content()
 
-	page2 := widget.NewLabel("Hello - Page 2")
-	page2.Alignment = fyne.TextAlignCenter
+	// 语音生成页面
+	page2 := NewGenerateView(v.window).Content()
 
+	// 其余页面暂时只显示"Hello"
 	page3 := widget.NewLabel("Hello - Page 3")
 	page3.Alignment = fyne.TextAlignCenter
 
 	// 创建标签页
 	v.tabs = container.NewAppTabs(
-		container.NewTabItem("", container.NewCenter(page1)),
-		container.NewTabItem("", container.NewCenter(page2)),
+		container.NewTabItem("", page1),
+		container.NewTabItem("", page2),
 		container.NewTabItem("", container.NewCenter(page3)),
 	)
 
@@ -55,10 +55,10 @@ func (v *MainView) createUI() {
 
 	// 创建页面切换按钮
 	pageButtons := container.NewHBox(
-		widget.NewButton("Page 1", func() {
+		widget.NewButton("脚本检查", func() {
 			v.tabs.SelectIndex(0)
 		}),
-		widget.NewButton("Page 2", func() {
+		widget.NewButton("语音生成", func() {
 			v.tabs.SelectIndex(1)
 		}),
 		widget.NewButton("Page 3", func() {
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultModelPathConfig 角色模型配置文件的默认路径
+var DefaultModelPathConfig = filepath.Join("config", "model_path.json")
+
+// CharacterModel 角色的一组GPT/SoVITS模型权重，路径相对于 GSV_Path
+// AudioIds、Tones 为空时该模型只能通过名称或作为默认模型被选中
+type CharacterModel struct {
+	Name          string   `json:"name,omitempty"` // 为空时取GPT权重的文件名，如 soyo-yami
+	GPTWeights    string   `json:"GPT_weights"`
+	SoVITSWeights string   `json:"SoVITS_weights"`
+	AudioIds      []string `json:"audioids,omitempty"` // 使用该模型的参考音频AudioId
+	Tones         []string `json:"tones,omitempty"`    // 使用该模型的语气
+}
+
+// VariantName 返回模型名称，未配置时从GPT权重文件名中去掉训练轮数，
+// 如 GPT_weights/soyo-yami-e30.ckpt 得到 soyo-yami
+func (m CharacterModel) VariantName() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	base := filepath.Base(filepath.ToSlash(m.GPTWeights))
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return epochSuffix.ReplaceAllString(base, "")
+}
+
+// epochSuffix 匹配权重文件名末尾的训练轮数，如 -e30、_e4_s56
+var epochSuffix = regexp.MustCompile(`[-_]e\d+(_s\d+)?$`)
+
+// matchesVariant 判断名称是否指向该模型，可以是完整名称或 - 之后的变体名（yami 匹配 soyo-yami）
+func (m CharacterModel) matchesVariant(key string) bool {
+	key = normalizeCharacterKey(key)
+	if key == "" {
+		return false
+	}
+	name := normalizeCharacterKey(m.VariantName())
+	return name == key || strings.HasSuffix(name, "-"+key) || strings.HasSuffix(name, "_"+key)
+}
+
+// containsKey 判断列表中是否有与 key 相同的项，忽略大小写
+func containsKey(list []string, key string) bool {
+	key = normalizeCharacterKey(key)
+	if key == "" {
+		return false
+	}
+	for _, item := range list {
+		if normalizeCharacterKey(item) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Character model_path.json 中的单个角色
+type Character struct {
+	Name    string           `json:"name"`
+	Aliases []string         `json:"aliases"`
+	Models  []CharacterModel `json:"Models"`
+}
+
+// ID 返回角色ID，取第一个别名（与立绘目录、figureId一致），没有别名时使用名称
+func (c *Character) ID() string {
+	if len(c.Aliases) > 0 {
+		return c.Aliases[0]
+	}
+	return c.Name
+}
+
+// SelectModel 为一句对话选择模型，优先级依次为：
+// 行内指定的模型名 override、AudioId（audioids 或模型名）、语气（tones），都不匹配时使用第一组模型
+func (c *Character) SelectModel(audioId, tone, override string) (CharacterModel, bool) {
+	if len(c.Models) == 0 {
+		return CharacterModel{}, false
+	}
+	for _, m := range c.Models {
+		if m.matchesVariant(override) {
+			return m, true
+		}
+	}
+	for _, m := range c.Models {
+		if containsKey(m.AudioIds, audioId) || m.matchesVariant(audioId) {
+			return m, true
+		}
+	}
+	for _, m := range c.Models {
+		if containsKey(m.Tones, tone) {
+			return m, true
+		}
+	}
+	return c.Models[0], true
+}
+
+// CharacterRegistry 角色表，支持按名称、别名和立绘模型路径查找角色
+type CharacterRegistry struct {
+	Characters []Character
+	index      map[string]int
+}
+
+// NewCharacterRegistry 根据角色列表创建角色表
+func NewCharacterRegistry(characters []Character) *CharacterRegistry {
+	r := &CharacterRegistry{
+		Characters: characters,
+		index:      make(map[string]int, len(characters)*3),
+	}
+	for i, c := range characters {
+		r.addKey(c.Name, i)
+		for _, alias := range c.Aliases {
+			r.addKey(alias, i)
+		}
+	}
+	return r
+}
+
+// LoadCharacterRegistry 从 model_path.json 加载角色表
+func LoadCharacterRegistry(path string) (*CharacterRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取角色配置失败: %w", err)
+	}
+
+	var characters []Character
+	if err := json.Unmarshal(data, &characters); err != nil {
+		return nil, fmt.Errorf("解析角色配置失败: %w", err)
+	}
+
+	return NewCharacterRegistry(characters), nil
+}
+
+// Validate 检查角色配置，返回发现的所有问题：
+// 角色没有名称或模型、别名被多个角色使用、同一角色的模型重名、权重文件在 gsvPath 下不存在
+// gsvPath 为空时不检查文件
+func (r *CharacterRegistry) Validate(gsvPath string) []error {
+	var errs []error
+	owner := make(map[string]string)
+
+	for _, c := range r.Characters {
+		if c.Name == "" {
+			errs = append(errs, fmt.Errorf("角色 %s 没有名称", c.ID()))
+		}
+		for _, key := range append([]string{c.Name}, c.Aliases...) {
+			key = normalizeCharacterKey(key)
+			if key == "" {
+				continue
+			}
+			if other, exists := owner[key]; exists && other != c.Name {
+				errs = append(errs, fmt.Errorf("名称 %s 同时属于角色 %s 和 %s", key, other, c.Name))
+				continue
+			}
+			owner[key] = c.Name
+		}
+
+		if len(c.Models) == 0 {
+			errs = append(errs, fmt.Errorf("角色 %s 没有配置模型", c.Name))
+		}
+		variants := make(map[string]bool)
+		for _, m := range c.Models {
+			variant := normalizeCharacterKey(m.VariantName())
+			if variants[variant] {
+				errs = append(errs, fmt.Errorf("角色 %s 有多个名为 %s 的模型", c.Name, m.VariantName()))
+			}
+			variants[variant] = true
+
+			errs = append(errs, checkWeightsFile(gsvPath, c.Name, "GPT", m.GPTWeights)...)
+			errs = append(errs, checkWeightsFile(gsvPath, c.Name, "SoVITS", m.SoVITSWeights)...)
+		}
+	}
+	return errs
+}
+
+// checkWeightsFile 检查权重文件是否存在，相对路径按 gsvPath 解析
+func checkWeightsFile(gsvPath, character, kind, path string) []error {
+	if path == "" {
+		return []error{fmt.Errorf("角色 %s 的%s权重路径为空", character, kind)}
+	}
+	if gsvPath == "" {
+		return nil
+	}
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(gsvPath, path)
+	}
+	if _, err := os.Stat(full); err != nil {
+		return []error{fmt.Errorf("角色 %s 的%s权重不存在: %s", character, kind, full)}
+	}
+	return nil
+}
+
+// addKey 添加索引，先出现的角色优先
+func (r *CharacterRegistry) addKey(key string, i int) {
+	key = normalizeCharacterKey(key)
+	if key == "" {
+		return
+	}
+	if _, exists := r.index[key]; !exists {
+		r.index[key] = i
+	}
+}
+
+// Lookup 按名称或别名查找角色
+func (r *CharacterRegistry) Lookup(name string) (*Character, bool) {
+	if r == nil {
+		return nil, false
+	}
+	i, ok := r.index[normalizeCharacterKey(name)]
+	if !ok {
+		return nil, false
+	}
+	return &r.Characters[i], true
+}
+
+// ResolveID 将说话人名称或别名解析为角色ID，未找到时返回空字符串
+func (r *CharacterRegistry) ResolveID(name string) string {
+	c, ok := r.Lookup(name)
+	if !ok {
+		return ""
+	}
+	return c.ID()
+}
+
+// ResolveFigureModel 根据立绘模型路径（如 anon/school_winter-2023/model.json）解析角色ID
+func (r *CharacterRegistry) ResolveFigureModel(modelPath string) string {
+	modelPath = filepath.ToSlash(strings.TrimSpace(modelPath))
+	if modelPath == "" || modelPath == "none" {
+		return ""
+	}
+	first, _, _ := strings.Cut(modelPath, "/")
+	return r.ResolveID(first)
+}
+
+// normalizeCharacterKey 统一名称格式，忽略首尾空白和英文大小写
+func normalizeCharacterKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
@@ -3,36 +3,81 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 )
 
-// StartGPTSvits 启动GPT-SoVITS服务
-func StartGPTSvits() error {
-	// 读取配置文件获取路径
-	configPath := filepath.Join("config", "gpt_svotis_path.json")
-	configData, err := os.ReadFile(configPath)
-	if err != nil {
-		return fmt.Errorf("读取配置文件失败: %v", err)
+// DefaultGSVConfig GPT-SoVITS 路径配置文件的默认路径
+var DefaultGSVConfig = filepath.Join("config", "gpt_svotis_path.json")
+
+// GPT-SoVITS api_v2 服务的默认地址
+const (
+	DefaultGSVHost = "127.0.0.1"
+	DefaultGSVPort = 9880
+)
+
+// GSVConfig gpt_svotis_path.json 的内容，客户端和启动器共用同一个地址，避免两边不一致
+type GSVConfig struct {
+	Path    string `json:"GSV_Path"` // GPT-SoVITS 安装目录，模型权重路径相对于该目录
+	Host    string `json:"host"`     // api_v2.py 的 -a 参数
+	Port    int    `json:"port"`     // api_v2.py 的 -p 参数
+	Timeout int    `json:"timeout"`  // 等待响应的超时秒数，0 表示使用默认值
+}
+
+// BaseURL 返回客户端访问服务的地址，服务监听所有地址时通过本机访问
+func (c *GSVConfig) BaseURL() string {
+	host := c.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = DefaultGSVHost
 	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(c.Port))
+}
 
-	var config struct {
-		GSV_Path string `json:"GSV_Path"`
+// LoadGSVConfig 读取 GPT-SoVITS 路径配置
+func LoadGSVConfig(path string) (*GSVConfig, error) {
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
 	}
+
+	var config GSVConfig
 	if err := json.Unmarshal(configData, &config); err != nil {
-		return fmt.Errorf("解析配置文件失败: %v", err)
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	if config.Host == "" {
+		config.Host = DefaultGSVHost
+	}
+	if config.Port == 0 {
+		config.Port = DefaultGSVPort
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return nil, fmt.Errorf("端口号无效: %d", config.Port)
+	}
+	return &config, nil
+}
+
+// StartGPTSvits 启动GPT-SoVITS服务
+func StartGPTSvits() error {
+	// 读取配置文件获取路径
+	config, err := LoadGSVConfig(DefaultGSVConfig)
+	if err != nil {
+		return err
 	}
 
-	// 构建命令
+	// 构建命令，在安装目录中运行，路径不拼接进命令行，包含空格或特殊字符也不受影响
 	cmd := exec.Command("powershell", "-Command",
-		fmt.Sprintf("cd %s; ./runtime/python api_v2.py -a 127.0.0.1 -p 9880 -c GPT_SoVITS/configs/tts_infer.yaml", config.GSV_Path))
+		fmt.Sprintf("./runtime/python api_v2.py -a %s -p %d -c GPT_SoVITS/configs/tts_infer.yaml", config.Host, config.Port))
+	cmd.Dir = config.Path
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("启动GPT-SoVITS失败: %v", err)
 	}
 
-	fmt.Println("GPT-SoVITS服务已启动")
+	fmt.Printf("GPT-SoVITS服务已启动: %s\n", config.BaseURL())
 	return nil
 }
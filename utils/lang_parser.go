@@ -133,3 +133,14 @@ func DetectLanguagesWithPercentage(text string) map[TextLanguage]float64 {
 		English:  englishPercent,
 	}
 }
+
+// TTSLang 将检测到的语言转换为GPT-SoVITS接受的语言参数
+func (l TextLanguage) TTSLang() string {
+	switch l {
+	case Chinese, Japanese, English:
+		return string(l)
+	default:
+		// 混合或无法识别的文本交给GPT-SoVITS自动切分
+		return "auto"
+	}
+}
@@ -186,6 +186,37 @@ func BuildReferenceAudioList(rootDir string) ([]AudioRefModel, error) {
 	return models, nil
 }
 
+// FindAudioRefSubDir 按角色ID（或名称）和AudioId查找参考音频目录
+// 未指定或找不到AudioId时使用该角色第一个有语气的子目录
+func FindAudioRefSubDir(refs []AudioRefModel, id, name, audioId string) (AudioRefSubDir, bool) {
+	for _, ref := range refs {
+		if !strings.EqualFold(ref.Model, id) && ref.Model != name {
+			continue
+		}
+		for _, subDir := range ref.SubDirs {
+			if subDir.AudioId == audioId && len(subDir.Tones) > 0 {
+				return subDir, true
+			}
+		}
+		for _, subDir := range ref.SubDirs {
+			if len(subDir.Tones) > 0 {
+				return subDir, true
+			}
+		}
+		return AudioRefSubDir{}, false
+	}
+	return AudioRefSubDir{}, false
+}
+
+// ToneNames 返回子目录中所有语气的名称
+func (d AudioRefSubDir) ToneNames() []string {
+	names := make([]string, 0, len(d.Tones))
+	for _, tone := range d.Tones {
+		names = append(names, tone.Tone)
+	}
+	return names
+}
+
 // ListReferenceAudioFiles 将音频参考列表序列化为JSON
 func ListReferenceAudioFiles(rootDir string) (string, error) {
 	models, err := BuildReferenceAudioList(rootDir)